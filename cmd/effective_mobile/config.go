@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+)
+
+const configCommand = "config"
+
+var errConfigUsage = errors.New("usage: effective_mobile [flags] config print")
+
+// runConfig runs config subcommand, args are arguments following it.
+func runConfig(conf *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errConfigUsage
+	}
+
+	return config.Print(os.Stdout, conf)
+}
@@ -2,73 +2,297 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
+	"github.com/HeadGardener/effective_mobile/internal/auth"
 	"github.com/HeadGardener/effective_mobile/internal/client"
 	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/grpchandlers"
 	"github.com/HeadGardener/effective_mobile/internal/handlers"
+	"github.com/HeadGardener/effective_mobile/internal/lifecycle"
+	"github.com/HeadGardener/effective_mobile/internal/logger"
+	"github.com/HeadGardener/effective_mobile/internal/ratelimit"
 	"github.com/HeadGardener/effective_mobile/internal/server"
 	"github.com/HeadGardener/effective_mobile/internal/services"
 	"github.com/HeadGardener/effective_mobile/internal/storage"
+	"github.com/HeadGardener/effective_mobile/internal/tracing"
 )
 
-const shutdownTimeout = 5 * time.Second
-
-var confPath = flag.String("conf-path", "./config/.env", "path to config env")
+// names of components managed by lifecycle.Manager
+const (
+	tracingComponent     = "tracing"
+	dbComponent          = "db"
+	dbReplicasComponent  = "db replicas"
+	jwksComponent        = "jwks refresher"
+	rateLimitComponent   = "rate limiter"
+	idempotencyComponent = "idempotency keys cleaner"
+	reloaderComponent    = "config reloader"
+	httpServerComponent  = "http server"
+	grpcServerComponent  = "grpc server"
+)
 
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 
-	conf, err := config.Init(*confPath)
+	conf, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		stop()
+		return
+	}
 	if err != nil {
 		stop()
-		log.Fatalf("[FATAL] error while initializing config: %s", err.Error())
+		log.Fatalf("[FATAL] error while initializing config:\n%s", err.Error())
 	}
 
-	db, err := storage.NewDB(conf.DBConfig)
+	var command string
+	if len(args) != 0 {
+		command, args = args[0], args[1:]
+	}
+
+	if command != "" && command != configCommand && command != migrateCommand {
+		stop()
+		log.Fatalf("[FATAL] unknown command %q, it must be %s or %s", command, configCommand, migrateCommand)
+	}
+
+	if command == configCommand {
+		err = runConfig(conf, args)
+		stop()
+		if err != nil {
+			log.Fatalf("[FATAL] %s", err.Error())
+		}
+		return
+	}
+
+	logLevel := new(slog.LevelVar)
+	slogger, err := logger.New(conf.LoggerConfig, logLevel)
+	if err != nil {
+		stop()
+		log.Fatalf("[FATAL] error while initializing logger: %s", err.Error())
+	}
+	// std log used below is routed to the logger too
+	slog.SetDefault(slogger)
+
+	shutdownTracing, err := tracing.Init(ctx, conf.TracingConfig)
+	if err != nil {
+		stop()
+		log.Fatalf("[FATAL] error while initializing tracing: %s", err.Error())
+	}
+
+	lc := lifecycle.NewManager(conf.ServerConfig, slogger)
+	lc.Add(lifecycle.Component{Name: tracingComponent, Stop: shutdownTracing})
+
+	db, err := storage.NewDB(ctx, conf.DBConfig, slogger)
 	if err != nil {
 		stop()
 		log.Fatalf("[FATAL] error while establishing db connection: %s", err.Error())
 	}
 
+	lc.Add(lifecycle.Component{
+		Name:      dbComponent,
+		DependsOn: []string{tracingComponent},
+		Stop: func(context.Context) error {
+			return db.Close()
+		},
+	})
+
+	if command == migrateCommand || conf.DBConfig.MigrateOnStart {
+		var migrator *storage.Migrator
+		if migrator, err = storage.NewMigrator(db.DB); err != nil {
+			stop()
+			log.Fatalf("[FATAL] error while loading migrations: %s", err.Error())
+		}
+
+		if command == migrateCommand {
+			err = runMigrate(ctx, slogger, migrator, args)
+			_ = db.Close()
+			stop()
+			if err != nil {
+				log.Fatalf("[FATAL] %s", err.Error())
+			}
+			return
+		}
+
+		if err = runMigrate(ctx, slogger, migrator, []string{"up"}); err != nil {
+			stop()
+			log.Fatalf("[FATAL] error while applying migrations: %s", err.Error())
+		}
+	}
+
+	// reads go to primary if there are no replicas
+	var replicas *storage.Replicas
+	if conf.DBConfig.ReplicaURLs != "" {
+		if replicas, err = storage.NewReplicas(ctx, conf.DBConfig, slogger); err != nil {
+			stop()
+			log.Fatalf("[FATAL] error while opening db replicas: %s", err.Error())
+		}
+
+		lc.Add(lifecycle.Component{
+			Name:      dbReplicasComponent,
+			DependsOn: []string{tracingComponent},
+			Run: func(ctx context.Context) error {
+				replicas.Run(ctx, conf.DBConfig.ReplicaCheckInterval)
+				return nil
+			},
+			Stop: func(context.Context) error {
+				return replicas.Close()
+			},
+		})
+	}
+
 	var (
-		personStorage = storage.NewPersonStorage(db)
+		personStorage = storage.NewPersonStorage(conf.TenantConfig, slogger, db.DB, replicas)
+		apiKeyStorage = storage.NewAPIKeyStorage(db.DB)
+		healthStorage = storage.NewHealthStorage(db.DB)
+		transactor    = storage.NewTransactor(conf.DBConfig, slogger, db.DB)
+
+		idempotencyStorage = storage.NewIdempotencyStorage(slogger, db.DB)
 	)
 
 	var (
-		httpClient = client.NewClient(conf.HTTPClientConfig)
+		httpClient = client.NewClient(conf.HTTPClientConfig, slogger)
 	)
 
 	var (
-		personService = services.NewPersonService(personStorage, httpClient)
+		personService = services.NewPersonService(conf.DuplicatesConfig, personStorage, httpClient, transactor)
+		apiKeyService = services.NewAPIKeyService(conf.AuthConfig, apiKeyStorage)
+		healthService = services.NewHealthService(healthStorage, httpClient)
 	)
 
-	handler := handlers.NewHandler(personService)
+	// servers are stopped before everything they use
+	serverDeps := []string{dbComponent}
+	if replicas != nil {
+		serverDeps = append(serverDeps, dbReplicasComponent)
+	}
 
-	srv := &server.Server{}
-	go func() {
-		if err = srv.Run(conf.ServerConfig, handler.InitRoutes()); err != nil {
-			log.Printf("[ERROR] failed to run server: %s", err.Error())
+	var jwtVerifier auth.TokenAuthenticator
+	if conf.AuthConfig.JWKSFile != "" || conf.AuthConfig.JWKSURL != "" {
+		loader := auth.JWKSFromFile(conf.AuthConfig.JWKSFile)
+		if conf.AuthConfig.JWKSURL != "" {
+			loader = auth.JWKSFromURL(conf.AuthConfig.JWKSURL, http.DefaultClient)
 		}
-	}()
-	log.Println("[INFO] server start working")
 
-	<-ctx.Done()
-	stop()
+		var jwks *auth.JWKS
+		if jwks, err = auth.NewJWKS(ctx, slogger, loader); err != nil {
+			stop()
+			log.Fatalf("[FATAL] error while loading jwks: %s", err.Error())
+		}
+		lc.Add(lifecycle.Component{
+			Name: jwksComponent,
+			Run: func(ctx context.Context) error {
+				jwks.Run(ctx, conf.AuthConfig.JWKSRefreshInterval)
+				return nil
+			},
+		})
+		serverDeps = append(serverDeps, jwksComponent)
+
+		jwtVerifier = auth.NewJWTVerifier(auth.JWTVerifierConfig{
+			Issuer:      conf.AuthConfig.JWTIssuer,
+			Audience:    conf.AuthConfig.JWTAudience,
+			ClockSkew:   conf.AuthConfig.JWTClockSkew,
+			ScopesClaim: conf.AuthConfig.JWTScopesClaim,
+			TenantClaim: conf.AuthConfig.JWTTenantClaim,
+		}, jwks)
+	}
+
+	authenticator := auth.NewRouter(jwtVerifier, apiKeyService)
+
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if conf.RateLimitConfig.Backend == config.RateLimitBackendPostgres {
+		rateLimitStore = storage.NewRateLimitStorage(db.DB)
+	}
+	rateLimiter := ratelimit.NewLimiter(conf.RateLimitConfig, slogger, rateLimitStore)
+	lc.Add(lifecycle.Component{
+		Name:      rateLimitComponent,
+		DependsOn: []string{dbComponent},
+		Run: func(ctx context.Context) error {
+			rateLimiter.Run(ctx, conf.RateLimitConfig.CleanupInterval)
+			return nil
+		},
+	})
+	serverDeps = append(serverDeps, rateLimitComponent)
+
+	lc.Add(lifecycle.Component{
+		Name:      idempotencyComponent,
+		DependsOn: []string{dbComponent},
+		Run: func(ctx context.Context) error {
+			idempotencyStorage.Run(ctx, conf.HandlerConfig.IdempotencyCleanupInterval)
+			return nil
+		},
+	})
+	serverDeps = append(serverDeps, idempotencyComponent)
 
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-	defer cancel()
+	handler := handlers.NewHandler(conf.HandlerConfig, slogger,
+		personService, apiKeyService, authenticator, rateLimiter, httpClient, healthService, idempotencyStorage)
+	grpcHandler := grpchandlers.NewHandler(conf.HandlerConfig, slogger, personService, authenticator)
 
-	if err = srv.Shutdown(ctx); err != nil {
-		log.Printf("[INFO] server forced to shutdown: %e", err)
+	reload := &reloader{
+		log:      slogger,
+		args:     os.Args[1:],
+		conf:     conf,
+		logLevel: logLevel,
+		client:   httpClient,
+		handler:  handler,
+		limiter:  rateLimiter,
 	}
+	lc.Add(lifecycle.Component{
+		Name: reloaderComponent,
+		Run: func(ctx context.Context) error {
+			reload.Run(ctx)
+			return nil
+		},
+	})
 
-	if err = db.Close(); err != nil {
-		log.Printf("[INFO] db connection forced to shutdown: %e", err)
+	router := handler.InitRoutes()
+	if err = handler.CheckOpenAPI(router); err != nil {
+		stop()
+		log.Fatalf("[FATAL] routes and openapi spec disagree: %s", err.Error())
+	}
+
+	// servers are built before lifecycle runs, so that they can be stopped before they start serving
+	srv, err := server.NewServer(conf.ServerConfig, router, slogger)
+	if err != nil {
+		stop()
+		log.Fatalf("[FATAL] failed to build http server: %s", err.Error())
+	}
+	lc.Add(lifecycle.Component{
+		Name:      httpServerComponent,
+		DependsOn: serverDeps,
+		Run: func(context.Context) error {
+			return srv.Run()
+		},
+		Stop: srv.Shutdown,
+	})
+
+	grpcSrv, err := server.NewGRPCServer(conf.GRPCConfig, conf.ServerConfig, grpcHandler.InitServer, slogger)
+	if err != nil {
+		stop()
+		log.Fatalf("[FATAL] failed to build grpc server: %s", err.Error())
+	}
+	lc.Add(lifecycle.Component{
+		Name:      grpcServerComponent,
+		DependsOn: serverDeps,
+		Run: func(context.Context) error {
+			return grpcSrv.Run()
+		},
+		Stop: grpcSrv.Shutdown,
+	})
+
+	// readiness fails from the start of shutdown, servers keep serving until load balancer notices it
+	lc.OnDrain(healthService.Drain)
+	// second signal kills the process stuck in shutdown
+	lc.OnDrain(stop)
+
+	err = lc.Run(ctx)
+	stop()
+	if err != nil {
+		log.Fatalf("[FATAL] %s", err.Error())
 	}
 
 	log.Println("[INFO] server exiting")
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/storage"
+	"github.com/pressly/goose/v3"
+)
+
+const migrateCommand = "migrate"
+
+var errMigrateUsage = errors.New("usage: effective_mobile [flags] migrate up|down|status|redo")
+
+// runMigrate runs migrate subcommand, args are arguments following it.
+func runMigrate(ctx context.Context, log *slog.Logger, migrator *storage.Migrator, args []string) error {
+	if len(args) != 1 {
+		return errMigrateUsage
+	}
+
+	switch args[0] {
+	case "up":
+		results, err := migrator.Up(ctx)
+		logMigrationResults(log, results...)
+		if len(results) == 0 && err == nil {
+			log.Info("no pending migrations")
+		}
+		return err
+	case "down":
+		result, err := migrator.Down(ctx)
+		logMigrationResults(log, result)
+		return err
+	case "redo":
+		results, err := migrator.Redo(ctx)
+		logMigrationResults(log, results...)
+		return err
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	default:
+		return errMigrateUsage
+	}
+}
+
+func logMigrationResults(log *slog.Logger, results ...*goose.MigrationResult) {
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+
+		if r.Error != nil {
+			log.Error("failed to apply migration", "migration", r.Source.Path, "direction", r.Direction,
+				"error", r.Error.Error())
+			continue
+		}
+
+		log.Info("applied migration", "migration", r.Source.Path, "direction", r.Direction,
+			"duration", r.Duration.String())
+	}
+}
+
+func printMigrationStatus(ctx context.Context, migrator *storage.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-26s %s\n", "Applied At", "Migration")
+	for _, s := range statuses {
+		appliedAt := "Pending"
+		if s.State == goose.StateApplied {
+			appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+
+		fmt.Printf("%-26s %s\n", appliedAt, s.Source.Path)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/client"
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/handlers"
+	"github.com/HeadGardener/effective_mobile/internal/logger"
+	"github.com/HeadGardener/effective_mobile/internal/ratelimit"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce joins bursts of events editors make while saving a file.
+const watchDebounce = 500 * time.Millisecond
+
+// reloader re-reads config on SIGHUP or, with reload.watch, on changes of config files and applies
+// reloadable settings to running components. Each component switches to new settings atomically.
+type reloader struct {
+	log  *slog.Logger
+	args []string
+	conf *config.Config
+
+	logLevel *slog.LevelVar
+	client   *client.Client
+	handler  *handlers.Handler
+	limiter  *ratelimit.Limiter
+}
+
+func (r *reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var changed <-chan struct{}
+	if r.conf.ReloadConfig.Watch {
+		changed = r.watch(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.log.Info("got SIGHUP, reloading config")
+			r.reload()
+		case <-changed:
+			r.log.Info("config file changed, reloading config")
+			r.reload()
+		}
+	}
+}
+
+func (r *reloader) reload() {
+	next, _, err := config.Load(r.args)
+	if err != nil {
+		r.log.Error("failed to reload config, keeping current one", "error", err.Error())
+		return
+	}
+
+	conf, rejected := config.Merge(r.conf, next)
+	for _, key := range rejected {
+		r.log.Warn("setting can't be changed without restart, keeping current value", "setting", key)
+	}
+
+	// level is already validated by Load
+	_ = logger.SetLevel(r.logLevel, conf.LoggerConfig.Level)
+	r.client.SetBaseURLs(conf.HTTPClientConfig)
+	r.limiter.SetLimits(conf.RateLimitConfig)
+	r.handler.Reload(conf.HandlerConfig)
+
+	r.conf = conf
+	r.log.Info("config reloaded")
+}
+
+// watch notifies about changes of files config was read from. Directories are watched, as editors
+// and configmap updates replace files rather than write them.
+func (r *reloader) watch(ctx context.Context) <-chan struct{} {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		r.log.Error("failed to watch config files", "error", err.Error())
+		return nil
+	}
+
+	files := make(map[string]bool, len(r.conf.Files))
+	for _, f := range r.conf.Files {
+		path, absErr := filepath.Abs(f)
+		if absErr != nil {
+			r.log.Error("failed to watch config file", "file", f, "error", absErr.Error())
+			continue
+		}
+		files[path] = true
+
+		if err = watcher.Add(filepath.Dir(path)); err != nil {
+			r.log.Error("failed to watch config file", "file", f, "error", err.Error())
+		}
+	}
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if files[event.Name] && event.Op != fsnotify.Chmod {
+					debounce = time.After(watchDebounce)
+				}
+			case <-debounce:
+				debounce = nil
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			case watchErr, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				r.log.Error("error while watching config files", "error", watchErr.Error())
+			}
+		}
+	}()
+
+	return changed
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "context"
+
+type TokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Router passes JWTs to JWT verifier and everything else to api keys authenticator.
+type Router struct {
+	jwt    TokenAuthenticator
+	apiKey TokenAuthenticator
+}
+
+// NewRouter creates Router, jwt may be nil if JWT authentication is not configured.
+func NewRouter(jwt, apiKey TokenAuthenticator) *Router {
+	return &Router{
+		jwt:    jwt,
+		apiKey: apiKey,
+	}
+}
+
+func (r *Router) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if r.jwt != nil && IsJWT(token) {
+		return r.jwt.Authenticate(ctx, token)
+	}
+
+	return r.apiKey.Authenticate(ctx, token)
+}
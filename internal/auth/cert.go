@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+)
+
+var (
+	ErrInvalidCertificate = errors.New("invalid client certificate")
+)
+
+// PrincipalFromCertificate returns principal of client certificate verified by mutual TLS. Subject common
+// name identifies principal, known scopes are taken from organizational units and tenant from organization,
+// certificates without organization belong to default tenant.
+func PrincipalFromCertificate(cert *x509.Certificate) (*Principal, error) {
+	subject := cert.Subject
+	if subject.CommonName == "" {
+		return nil, fmt.Errorf("%w: subject has no common name", ErrInvalidCertificate)
+	}
+
+	scopes := make([]Scope, 0, len(subject.OrganizationalUnit))
+	for _, unit := range subject.OrganizationalUnit {
+		if knownScopes[Scope(unit)] {
+			scopes = append(scopes, Scope(unit))
+		}
+	}
+
+	tenantID := tenant.Default
+	if len(subject.Organization) != 0 {
+		tenantID = subject.Organization[0]
+		if err := tenant.ValidateID(tenantID); err != nil {
+			return nil, fmt.Errorf("%w: organization: %s", ErrInvalidCertificate, err.Error())
+		}
+	}
+
+	return &Principal{
+		ID:       "cert:" + subject.CommonName,
+		Name:     subject.String(),
+		Scopes:   scopes,
+		TenantID: tenantID,
+	}, nil
+}
@@ -0,0 +1,10 @@
+package auth
+
+import "time"
+
+// ExpireRefresh makes the next unknown kid trigger refresh, as if minRefreshInterval has passed.
+func (s *JWKS) ExpireRefresh() {
+	s.refreshMu.Lock()
+	s.lastAttempt = time.Time{}
+	s.refreshMu.Unlock()
+}
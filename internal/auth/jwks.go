@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// minRefreshInterval limits refreshes triggered by tokens signed with unknown kid.
+	minRefreshInterval = 10 * time.Second
+	maxJWKSSize        = 1 << 20
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// JWKSLoader returns raw JSON Web Key Set.
+type JWKSLoader func(ctx context.Context) ([]byte, error)
+
+// JWKSFromFile loads key set from local file, it is reread on every refresh, so keys can be rotated
+// by replacing the file.
+func JWKSFromFile(path string) JWKSLoader {
+	return func(_ context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+// JWKSFromURL loads key set from identity provider, e.g. https://sso.example.com/.well-known/jwks.json.
+func JWKSFromURL(url string, cl *http.Client) JWKSLoader {
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := cl.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch jwks: unexpected status %d", resp.StatusCode)
+		}
+
+		return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	}
+}
+
+// JWKS is a set of public keys by kid, refreshed periodically and on demand when unknown kid is met.
+type JWKS struct {
+	log    *slog.Logger
+	loader JWKSLoader
+
+	mu   sync.RWMutex
+	keys map[string]crypto.PublicKey
+
+	refreshMu sync.Mutex
+	// lastAttempt is time of the last refresh, successful or not, it's guarded by refreshMu.
+	lastAttempt time.Time
+}
+
+func NewJWKS(ctx context.Context, log *slog.Logger, loader JWKSLoader) (*JWKS, error) {
+	s := &JWKS{
+		log:    log,
+		loader: loader,
+		keys:   make(map[string]crypto.PublicKey),
+	}
+
+	if err := s.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewStaticJWKS creates key set which is never refreshed, it is handy for locally generated keys.
+func NewStaticJWKS(keys map[string]crypto.PublicKey) *JWKS {
+	return &JWKS{
+		log:  slog.Default(),
+		keys: keys,
+	}
+}
+
+// Refresh reloads keys. On failure previously loaded keys are kept.
+func (s *JWKS) Refresh(ctx context.Context) error {
+	if s.loader == nil {
+		return nil
+	}
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	return s.refresh(ctx)
+}
+
+// refreshIfStale refreshes keys unless they were refreshed or failed to refresh less than minRefreshInterval ago,
+// concurrent callers wait for the single refresh.
+func (s *JWKS) refreshIfStale(ctx context.Context) error {
+	if s.loader == nil {
+		return nil
+	}
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	if time.Since(s.lastAttempt) < minRefreshInterval {
+		return nil
+	}
+
+	return s.refresh(ctx)
+}
+
+func (s *JWKS) refresh(ctx context.Context) error {
+	s.lastAttempt = time.Now()
+
+	raw, err := s.loader(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load jwks: %w", err)
+	}
+
+	keys, err := ParseJWKS(raw)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Run refreshes keys every interval until ctx is done.
+func (s *JWKS) Run(ctx context.Context, interval time.Duration) {
+	if s.loader == nil || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				s.log.ErrorContext(ctx, "failed to refresh jwks", "error", err.Error())
+			}
+		}
+	}
+}
+
+// Key returns key by kid. Unknown kid triggers refresh, as the key might have been just rotated.
+func (s *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	if err := s.refreshIfStale(ctx); err != nil {
+		s.log.ErrorContext(ctx, "failed to refresh jwks", "error", err.Error())
+	}
+
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+func (s *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[kid]
+	if !ok && kid == "" && len(s.keys) == 1 {
+		// tokens without kid are accepted only when there is no ambiguity
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+
+	return key, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS parses RSA and EC public keys of JSON Web Key Set, keys of other types are skipped.
+func ParseJWKS(raw []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i := range set.Keys {
+		k := &set.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaKey()
+		case "EC":
+			key, err = k.ecKey()
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwks doesn't contain signing keys")
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.IsInt64() {
+		return nil, errors.New("rsa exponent is too big")
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k *jwk) ecKey() (*ecdsa.PublicKey, error) {
+	var (
+		curve     elliptic.Curve
+		ecdhCurve ecdh.Curve
+	)
+	switch k.Crv {
+	case "P-256":
+		curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	// ecdh validates that the point is on the curve
+	size := (curve.Params().BitSize + 7) / 8
+	if len(x.Bytes()) > size || len(y.Bytes()) > size {
+		return nil, errors.New("point is not on curve")
+	}
+
+	point := make([]byte, 1+2*size)
+	point[0] = 4
+	x.FillBytes(point[1 : 1+size])
+	y.FillBytes(point[1+size:])
+
+	if _, err = ecdhCurve.NewPublicKey(point); err != nil {
+		return nil, errors.New("point is not on curve")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(raw), nil
+}
@@ -0,0 +1,89 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+)
+
+func rsaJWKS(t *testing.T, kid string) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %s", err)
+	}
+
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	return []byte(fmt.Sprintf(`{"keys": [{"kty": "RSA", "kid": %q, "use": "sig", "n": %q, "e": %q}]}`, kid, n, e))
+}
+
+func TestUnknownKIDRefreshesOnceAndFailuresAreRateLimited(t *testing.T) {
+	raw := rsaJWKS(t, rsaKID)
+
+	var loads atomic.Int32
+	loader := func(context.Context) ([]byte, error) {
+		if loads.Add(1) == 1 {
+			return raw, nil
+		}
+		// slow failing provider, so that concurrent lookups overlap with refresh
+		time.Sleep(20 * time.Millisecond)
+		return nil, errors.New("provider is down")
+	}
+
+	keys, err := auth.NewJWKS(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)), loader)
+	if err != nil {
+		t.Fatalf("failed to load jwks: %s", err)
+	}
+
+	if _, err = keys.Key(context.Background(), "other-key"); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("expected no refresh right after loading, got %d loads", n)
+	}
+
+	keys.ExpireRefresh()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, keyErr := keys.Key(context.Background(), "other-key"); !errors.Is(keyErr, auth.ErrUnknownKey) {
+				t.Errorf("expected ErrUnknownKey, got %v", keyErr)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("expected concurrent lookups to share a single refresh, got %d loads", n)
+	}
+
+	// failed refresh is rate limited as well as successful one
+	if _, err = keys.Key(context.Background(), "other-key"); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("expected no refresh after failed one, got %d loads", n)
+	}
+
+	// keys loaded before failure are kept
+	if _, err = keys.Key(context.Background(), rsaKID); err != nil {
+		t.Fatalf("failed to get loaded key: %s", err)
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultScopesClaim = "scope"
+	defaultTenantClaim = "tenant_id"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+type JWTVerifierConfig struct {
+	Issuer   string
+	Audience string
+	// ClockSkew is tolerated difference between clocks of issuer and the service.
+	ClockSkew time.Duration
+	// ScopesClaim holds scopes either as space separated string or as array, "scope" by default.
+	ScopesClaim string
+	// TenantClaim holds tenant of the subject, "tenant_id" by default. Tokens without it belong to default tenant.
+	TenantClaim string
+}
+
+// JWTVerifier verifies RS256 and ES256 signed tokens with keys from JWKS and maps their claims onto Principal.
+type JWTVerifier struct {
+	keys        *JWKS
+	parser      *jwt.Parser
+	scopesClaim string
+	tenantClaim string
+}
+
+func NewJWTVerifier(conf JWTVerifierConfig, keys *JWKS) *JWTVerifier {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithLeeway(conf.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+
+	if conf.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(conf.Issuer))
+	}
+
+	if conf.Audience != "" {
+		opts = append(opts, jwt.WithAudience(conf.Audience))
+	}
+
+	scopesClaim := conf.ScopesClaim
+	if scopesClaim == "" {
+		scopesClaim = defaultScopesClaim
+	}
+
+	tenantClaim := conf.TenantClaim
+	if tenantClaim == "" {
+		tenantClaim = defaultTenantClaim
+	}
+
+	return &JWTVerifier{
+		keys:        keys,
+		parser:      jwt.NewParser(opts...),
+		scopesClaim: scopesClaim,
+		tenantClaim: tenantClaim,
+	}
+}
+
+func (v *JWTVerifier) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+
+	if _, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+	}
+
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, fmt.Errorf("%w: sub claim is required", ErrInvalidToken)
+	}
+
+	scopes, err := v.scopes(claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+	}
+
+	tenantID := tenant.Default
+	if value, ok := claims[v.tenantClaim]; ok {
+		id, _ := value.(string)
+		if err = tenant.ValidateID(id); err != nil {
+			return nil, fmt.Errorf("%w: %s claim: %s", ErrInvalidToken, v.tenantClaim, err.Error())
+		}
+		tenantID = id
+	}
+
+	name := sub
+	if username, ok := claims["preferred_username"].(string); ok && username != "" {
+		name = username
+	}
+
+	return &Principal{
+		ID:       sub,
+		Name:     name,
+		Scopes:   scopes,
+		TenantID: tenantID,
+	}, nil
+}
+
+// scopes picks known scopes from the claim, unknown ones are issued for other services and are ignored.
+func (v *JWTVerifier) scopes(claims jwt.MapClaims) ([]Scope, error) {
+	var raw []string
+
+	switch value := claims[v.scopesClaim].(type) {
+	case nil:
+	case string:
+		raw = strings.Fields(value)
+	case []any:
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s claim must contain strings", v.scopesClaim)
+			}
+			raw = append(raw, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s claim must be a string or an array", v.scopesClaim)
+	}
+
+	scopes := make([]Scope, 0, len(raw))
+	for _, s := range raw {
+		if knownScopes[Scope(s)] {
+			scopes = append(scopes, Scope(s))
+		}
+	}
+
+	return scopes, nil
+}
+
+// IsJWT reports whether token looks like compact serialized JWT rather than an api key.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,200 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	rsaKID   = "rsa-key"
+	ecKID    = "ec-key"
+	issuer   = "https://issuer.example.com"
+	audience = "effective_mobile"
+)
+
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newVerifier(t *testing.T) (*auth.JWTVerifier, testKeys) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ec key: %s", err)
+	}
+
+	keys := auth.NewStaticJWKS(map[string]crypto.PublicKey{
+		rsaKID: &rsaKey.PublicKey,
+		ecKID:  &ecKey.PublicKey,
+	})
+
+	verifier := auth.NewJWTVerifier(auth.JWTVerifierConfig{
+		Issuer:    issuer,
+		Audience:  audience,
+		ClockSkew: time.Second,
+	}, keys)
+
+	return verifier, testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":       issuer,
+		"aud":       audience,
+		"sub":       "user-1",
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Hour).Unix(),
+		"scope":     "persons:read persons:write openid",
+		"tenant_id": "acme",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims, key any) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %s", err)
+	}
+
+	return signed
+}
+
+func TestAuthenticateValidTokens(t *testing.T) {
+	verifier, keys := newVerifier(t)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "RS256", token: sign(t, jwt.SigningMethodRS256, rsaKID, validClaims(), keys.rsa)},
+		{name: "ES256", token: sign(t, jwt.SigningMethodES256, ecKID, validClaims(), keys.ec)},
+	}
+
+	for _, tt := range tests {
+		principal, err := verifier.Authenticate(context.Background(), tt.token)
+		if err != nil {
+			t.Errorf("%s: failed to authenticate: %s", tt.name, err)
+			continue
+		}
+
+		if principal.ID != "user-1" || principal.TenantID != "acme" {
+			t.Errorf("%s: unexpected principal %+v", tt.name, principal)
+		}
+		// unknown scopes are issued for other services and are dropped
+		if !slices.Equal(principal.Scopes, []auth.Scope{auth.ScopePersonsRead, auth.ScopePersonsWrite}) {
+			t.Errorf("%s: unexpected scopes %v", tt.name, principal.Scopes)
+		}
+	}
+}
+
+func TestAuthenticateWithoutTenantClaim(t *testing.T) {
+	verifier, keys := newVerifier(t)
+
+	claims := validClaims()
+	delete(claims, "tenant_id")
+
+	principal, err := verifier.Authenticate(context.Background(), sign(t, jwt.SigningMethodRS256, rsaKID, claims, keys.rsa))
+	if err != nil {
+		t.Fatalf("failed to authenticate: %s", err)
+	}
+	if principal.TenantID != tenant.Default {
+		t.Fatalf("expected default tenant, got %q", principal.TenantID)
+	}
+}
+
+func TestAuthenticateRejectsInvalidTokens(t *testing.T) {
+	verifier, keys := newVerifier(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %s", err)
+	}
+
+	expired := validClaims()
+	expired["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	withoutExp := validClaims()
+	delete(withoutExp, "exp")
+
+	foreignIssuer := validClaims()
+	foreignIssuer["iss"] = "https://other.example.com"
+
+	foreignAudience := validClaims()
+	foreignAudience["aud"] = "other-service"
+
+	withoutSubject := validClaims()
+	delete(withoutSubject, "sub")
+
+	invalidTenant := validClaims()
+	invalidTenant["tenant_id"] = "not a tenant"
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "expired", token: sign(t, jwt.SigningMethodRS256, rsaKID, expired, keys.rsa)},
+		{name: "without exp", token: sign(t, jwt.SigningMethodRS256, rsaKID, withoutExp, keys.rsa)},
+		{name: "unknown kid", token: sign(t, jwt.SigningMethodRS256, "other-key", validClaims(), keys.rsa)},
+		{name: "kid of another key", token: sign(t, jwt.SigningMethodRS256, ecKID, validClaims(), keys.rsa)},
+		{name: "signed by another key", token: sign(t, jwt.SigningMethodRS256, rsaKID, validClaims(), otherKey)},
+		{name: "HS256", token: sign(t, jwt.SigningMethodHS256, rsaKID, validClaims(), []byte("secret"))},
+		{name: "RS512", token: sign(t, jwt.SigningMethodRS512, rsaKID, validClaims(), keys.rsa)},
+		{name: "none", token: sign(t, jwt.SigningMethodNone, rsaKID, validClaims(), jwt.UnsafeAllowNoneSignatureType)},
+		{name: "foreign issuer", token: sign(t, jwt.SigningMethodRS256, rsaKID, foreignIssuer, keys.rsa)},
+		{name: "foreign audience", token: sign(t, jwt.SigningMethodRS256, rsaKID, foreignAudience, keys.rsa)},
+		{name: "without subject", token: sign(t, jwt.SigningMethodRS256, rsaKID, withoutSubject, keys.rsa)},
+		{name: "invalid tenant", token: sign(t, jwt.SigningMethodRS256, rsaKID, invalidTenant, keys.rsa)},
+	}
+
+	for _, tt := range tests {
+		principal, err := verifier.Authenticate(context.Background(), tt.token)
+		if !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got principal %+v and error %v", tt.name, principal, err)
+		}
+	}
+}
+
+func TestTokenWithoutKIDNeedsSingleKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %s", err)
+	}
+
+	single := auth.NewJWTVerifier(auth.JWTVerifierConfig{}, auth.NewStaticJWKS(map[string]crypto.PublicKey{
+		rsaKID: &rsaKey.PublicKey,
+	}))
+	if _, err = single.Authenticate(context.Background(), sign(t, jwt.SigningMethodRS256, "", validClaims(), rsaKey)); err != nil {
+		t.Fatalf("token without kid isn't accepted by the only key: %s", err)
+	}
+
+	several, keys := newVerifier(t)
+	if _, err = several.Authenticate(context.Background(), sign(t, jwt.SigningMethodRS256, "", validClaims(), keys.rsa)); err == nil {
+		t.Fatal("token without kid is accepted when there are several keys")
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type Scope string
+
+const (
+	ScopePersonsRead   Scope = "persons:read"
+	ScopePersonsWrite  Scope = "persons:write"
+	ScopePersonsDelete Scope = "persons:delete"
+	ScopeAdmin         Scope = "admin"
+)
+
+var knownScopes = map[Scope]bool{
+	ScopePersonsRead:   true,
+	ScopePersonsWrite:  true,
+	ScopePersonsDelete: true,
+	ScopeAdmin:         true,
+}
+
+// Principal is an authenticated caller of the api.
+type Principal struct {
+	// ID identifies principal, e.g. api key id.
+	ID     string
+	Name   string
+	Scopes []Scope
+	// TenantID is tenant whose persons principal works with.
+	TenantID string
+	// SuperAdmin may create api keys of other tenants, only bootstrap key is.
+	SuperAdmin bool
+}
+
+// HasScope reports whether principal is granted scope, admin is granted every scope.
+func (p *Principal) HasScope(scope Scope) bool {
+	if p == nil {
+		return false
+	}
+
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsSuperAdmin reports whether principal is super admin, it is false for nil principal.
+func (p *Principal) IsSuperAdmin() bool {
+	return p != nil && p.SuperAdmin
+}
+
+type principalCtxKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, p)
+}
+
+// PrincipalFrom returns principal put into ctx by auth middleware, nil if request is anonymous.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalCtxKey{}).(*Principal)
+	return p
+}
+
+// ParseScopes parses space separated list of scopes, like it is stored in db.
+func ParseScopes(s string) ([]Scope, error) {
+	fields := strings.Fields(s)
+	scopes := make([]Scope, 0, len(fields))
+
+	for _, f := range fields {
+		scope := Scope(f)
+		if !knownScopes[scope] {
+			return nil, fmt.Errorf("unknown scope %q", f)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return scopes, nil
+}
+
+func JoinScopes(scopes []Scope) string {
+	s := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		s = append(s, string(scope))
+	}
+
+	return strings.Join(s, " ")
+}
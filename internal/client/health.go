@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/models"
+)
+
+// CheckUpstreams sends HEAD request without name to every enrichment api concurrently. Such requests
+// aren't counted by the apis, so checks don't consume quotas.
+func (c *Client) CheckUpstreams(ctx context.Context) []models.UpstreamHealth {
+	urls := c.baseURLs.Load()
+	upstreams := []struct {
+		name string
+		url  string
+	}{
+		{name: ageUpstream, url: urls.age},
+		{name: genderUpstream, url: urls.gender},
+		{name: nationalityUpstream, url: urls.nationality},
+	}
+
+	health := make([]models.UpstreamHealth, len(upstreams))
+
+	var wg sync.WaitGroup
+	for i := range upstreams {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			health[i] = c.checkUpstream(ctx, upstreams[i].name, upstreams[i].url)
+		}(i)
+	}
+	wg.Wait()
+
+	return health
+}
+
+func (c *Client) checkUpstream(ctx context.Context, upstream, url string) models.UpstreamHealth {
+	health := models.UpstreamHealth{
+		Upstream: upstream,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, http.NoBody)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	start := time.Now()
+	resp, err := c.cl.Do(req)
+	health.Latency = time.Since(start)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	_ = resp.Body.Close()
+
+	health.Reachable = true
+
+	return health
+}
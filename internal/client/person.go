@@ -4,42 +4,97 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
+	"sync/atomic"
+	"time"
 
 	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/logger"
+	"github.com/HeadGardener/effective_mobile/internal/metrics"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	nameQueryParam = "?name="
+
+	ageUpstream         = "agify"
+	genderUpstream      = "genderize"
+	nationalityUpstream = "nationalize"
 )
 
+// errSkipped is returned when request isn't sent because quota is exhausted in degrade mode,
+// persons are saved without the data then.
+var errSkipped = errors.New("request skipped in degraded mode")
+
+var tracer = tracing.Tracer("internal/client")
+
 type Client struct {
-	debugLogger        *slog.Logger
-	cl                 *http.Client
-	ageBaseURL         string
-	genderBaseURL      string
-	nationalityBaseURL string
+	log      *slog.Logger
+	cl       *http.Client
+	baseURLs atomic.Pointer[baseURLs]
+
+	ageQuota         *quota
+	genderQuota      *quota
+	nationalityQuota *quota
 }
 
-func NewClient(conf config.HTTPClientConfig) *Client {
-	return &Client{
-		debugLogger:        slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})),
-		cl:                 http.DefaultClient,
-		ageBaseURL:         conf.AgeBaseURL,
-		genderBaseURL:      conf.GenderBaseURL,
-		nationalityBaseURL: conf.NationalityBaseURL,
+type baseURLs struct {
+	age         string
+	gender      string
+	nationality string
+}
+
+func NewClient(conf config.HTTPClientConfig, log *slog.Logger) *Client {
+	c := &Client{
+		log:              log,
+		cl:               http.DefaultClient,
+		ageQuota:         newQuota(ageUpstream, conf.QuotaMode, conf.QuotaReserve),
+		genderQuota:      newQuota(genderUpstream, conf.QuotaMode, conf.QuotaReserve),
+		nationalityQuota: newQuota(nationalityUpstream, conf.QuotaMode, conf.QuotaReserve),
+	}
+	c.SetBaseURLs(conf)
+
+	return c
+}
+
+// SetBaseURLs replaces urls of all enrichment apis at once, requests in flight finish with old ones.
+func (c *Client) SetBaseURLs(conf config.HTTPClientConfig) {
+	c.baseURLs.Store(&baseURLs{
+		age:         conf.AgeBaseURL,
+		gender:      conf.GenderBaseURL,
+		nationality: conf.NationalityBaseURL,
+	})
+}
+
+// Quotas returns request quotas of every enrichment api.
+func (c *Client) Quotas() []models.UpstreamQuota {
+	return []models.UpstreamQuota{
+		c.ageQuota.status(),
+		c.genderQuota.status(),
+		c.nationalityQuota.status(),
 	}
 }
 
 func (c *Client) GetAge(ctx context.Context, name string) (int8, error) {
-	resp, err := c.sendGetRequest(ctx, c.ageBaseURL+nameQueryParam+name)
+	resp, err := c.sendGetRequest(ctx, c.ageQuota, c.baseURLs.Load().age+nameQueryParam+name)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 
+	if errors.Is(err, errSkipped) {
+		return 0, nil
+	}
+
 	if err != nil {
 		return 0, err
 	}
@@ -57,11 +112,15 @@ func (c *Client) GetAge(ctx context.Context, name string) (int8, error) {
 }
 
 func (c *Client) GetGender(ctx context.Context, name string) (string, error) {
-	resp, err := c.sendGetRequest(ctx, c.genderBaseURL+nameQueryParam+name)
+	resp, err := c.sendGetRequest(ctx, c.genderQuota, c.baseURLs.Load().gender+nameQueryParam+name)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 
+	if errors.Is(err, errSkipped) {
+		return "", nil
+	}
+
 	if err != nil {
 		return "", err
 	}
@@ -79,11 +138,15 @@ func (c *Client) GetGender(ctx context.Context, name string) (string, error) {
 }
 
 func (c *Client) GetNationality(ctx context.Context, name string) (string, error) {
-	resp, err := c.sendGetRequest(ctx, c.nationalityBaseURL+nameQueryParam+name)
+	resp, err := c.sendGetRequest(ctx, c.nationalityQuota, c.baseURLs.Load().nationality+nameQueryParam+name)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 
+	if errors.Is(err, errSkipped) {
+		return "NONE", nil
+	}
+
 	if err != nil {
 		return "", err
 	}
@@ -107,21 +170,74 @@ func (c *Client) GetNationality(ctx context.Context, name string) (string, error
 	return nationality.Country[0].CountryID, nil
 }
 
-func (c *Client) sendGetRequest(ctx context.Context, url string) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, bytes.NewBuffer([]byte("")))
+// sendGetRequest sends request within quota of upstream, propagating trace context in traceparent header.
+// Response is returned even with error, so that caller closes its body.
+func (c *Client) sendGetRequest(ctx context.Context, q *quota, reqURL string) (_ *http.Response, err error) {
+	// span includes time spent waiting for quota
+	ctx, span := tracer.Start(ctx, "GET "+q.upstream, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.PeerService(q.upstream), semconv.HTTPMethod(http.MethodGet)))
+	defer func() {
+		if errors.Is(err, errSkipped) {
+			span.SetAttributes(attribute.Bool("enrichment.skipped", true))
+			tracing.End(span, nil)
+			return
+		}
+		tracing.End(span, err)
+	}()
+
+	allowed, err := q.acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	if !allowed {
+		c.log.WarnContext(ctx, "skipped GET request, quota is exhausted", "upstream", q.upstream)
+		return nil, errSkipped
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, bytes.NewBuffer([]byte("")))
+	if err != nil {
+		return nil, withoutURL(err)
+	}
+
 	req.Header.Set("Accept", "application/json; charset=utf-8")
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
+	start := time.Now()
 	resp, err := c.cl.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		metrics.ObserveUpstreamRequest(q.upstream, 0, start)
+		metrics.IncUpstreamError(q.upstream, "network")
+		return nil, fmt.Errorf("failed to send request to %s: %w", q.upstream, withoutURL(err))
 	}
 
-	c.debugLogger.Debug("sent GET request", "url", url, "status", resp.StatusCode)
+	metrics.ObserveUpstreamRequest(q.upstream, resp.StatusCode, start)
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+	c.log.DebugContext(ctx, "sent GET request", logger.PII("url", reqURL), "status", resp.StatusCode)
+
+	q.update(resp)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		metrics.IncUpstreamError(q.upstream, "quota")
+		if q.mode == config.QuotaModeDegrade {
+			return resp, errSkipped
+		}
+		return resp, fmt.Errorf("%w: %s rejected request", ErrQuotaExhausted, q.upstream)
+	case resp.StatusCode != http.StatusOK:
+		metrics.IncUpstreamError(q.upstream, "status")
+		return resp, fmt.Errorf("%s responded with unexpected status %d", q.upstream, resp.StatusCode)
+	}
 
 	return resp, nil
 }
+
+// withoutURL drops url from url.Error, since its query contains name of person, which must not reach logs.
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
+	}
+	return err
+}
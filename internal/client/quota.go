@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+)
+
+const (
+	rateLimitLimitHeader     = "X-Rate-Limit-Limit"
+	rateLimitRemainingHeader = "X-Rate-Limit-Remaining"
+	rateLimitResetHeader     = "X-Rate-Limit-Reset"
+	retryAfterHeader         = "Retry-After"
+
+	// defaultQuotaReset is used when upstream rejects request without telling when quota is reset.
+	defaultQuotaReset = time.Minute
+	unknownRemaining  = -1
+)
+
+var (
+	ErrQuotaExhausted = errors.New("enrichment api quota is exhausted")
+)
+
+// quota tracks remaining requests of upstream by its X-Rate-Limit-* headers. Remaining count is
+// decremented before every request, so that concurrent requests don't overrun it between responses.
+type quota struct {
+	upstream string
+	mode     string
+	reserve  int
+
+	mu        sync.Mutex
+	limit     int
+	remaining int
+	resetAt   time.Time
+	// changed is closed and replaced when upstream reports quota, so that waiters recheck it
+	changed chan struct{}
+}
+
+func newQuota(upstream, mode string, reserve int) *quota {
+	return &quota{
+		upstream:  upstream,
+		mode:      mode,
+		reserve:   reserve,
+		limit:     unknownRemaining,
+		remaining: unknownRemaining,
+		changed:   make(chan struct{}),
+	}
+}
+
+// acquire reserves one request. When only reserve is left, it either waits for quota reset or,
+// in degrade mode, reports that request must be skipped. Waiters are admitted one by one against
+// quota of the new window, the rest keep waiting.
+func (q *quota) acquire(ctx context.Context) (bool, error) {
+	for {
+		q.mu.Lock()
+
+		if !q.resetAt.IsZero() && !time.Now().Before(q.resetAt) {
+			q.resetAt = time.Time{}
+			// if limit is unknown, the only request let through finds out quota of the new window
+			q.remaining = q.reserve + 1
+			if q.limit != unknownRemaining {
+				q.remaining = max(q.limit, q.reserve+1)
+			}
+		}
+
+		if q.remaining == unknownRemaining || q.remaining > q.reserve {
+			if q.remaining != unknownRemaining {
+				q.remaining--
+			}
+			q.mu.Unlock()
+			return true, nil
+		}
+
+		if q.mode == config.QuotaModeDegrade {
+			q.mu.Unlock()
+			return false, nil
+		}
+
+		if q.resetAt.IsZero() {
+			q.resetAt = time.Now().Add(defaultQuotaReset)
+		}
+		timer := time.NewTimer(time.Until(q.resetAt))
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, errors.Join(ErrQuotaExhausted, ctx.Err())
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// update records quota reported by upstream.
+func (q *quota) update(resp *http.Response) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	defer func() {
+		close(q.changed)
+		q.changed = make(chan struct{})
+	}()
+
+	if limit, err := strconv.Atoi(resp.Header.Get(rateLimitLimitHeader)); err == nil {
+		q.limit = limit
+	}
+
+	if remaining, err := strconv.Atoi(resp.Header.Get(rateLimitRemainingHeader)); err == nil {
+		q.remaining = remaining
+	} else if resp.StatusCode != http.StatusTooManyRequests {
+		// upstream doesn't report quota, so requests aren't held back
+		q.remaining = unknownRemaining
+	}
+
+	reset, err := strconv.Atoi(resp.Header.Get(rateLimitResetHeader))
+	if err != nil {
+		reset, err = strconv.Atoi(resp.Header.Get(retryAfterHeader))
+	}
+	if err == nil {
+		q.resetAt = time.Now().Add(time.Duration(reset) * time.Second)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		q.remaining = 0
+		if q.resetAt.IsZero() {
+			q.resetAt = time.Now().Add(defaultQuotaReset)
+		}
+	}
+}
+
+func (q *quota) status() models.UpstreamQuota {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := models.UpstreamQuota{
+		Upstream:  q.upstream,
+		Mode:      q.mode,
+		Limit:     q.limit,
+		Remaining: q.remaining,
+		ResetAt:   q.resetAt,
+	}
+	status.Exhausted = q.remaining != unknownRemaining && q.remaining <= q.reserve &&
+		(q.resetAt.IsZero() || time.Now().Before(q.resetAt))
+
+	return status
+}
@@ -2,90 +2,376 @@ package config
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"reflect"
 	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
+const (
+	DBPoolStdlib  = "stdlib"
+	DBPoolPgxpool = "pgxpool"
+
+	TxIsolationReadCommitted  = "read_committed"
+	TxIsolationRepeatableRead = "repeatable_read"
+	TxIsolationSerializable   = "serializable"
+
+	RateLimitBackendMemory   = "memory"
+	RateLimitBackendPostgres = "postgres"
+
+	QuotaModeQueue   = "queue"
+	QuotaModeDegrade = "degrade"
+
+	TLSClientAuthOptional = "optional"
+	TLSClientAuthRequire  = "require"
+
+	DuplicatePolicyAllow          = "allow"
+	DuplicatePolicyReject         = "reject"
+	DuplicatePolicyReturnExisting = "return_existing"
+)
+
+// Config is read in layers: defaults from `default` tags, then YAML file, then environment variables
+// named by `env` tags, then command line flags named after YAML keys, e.g. -server.read-timeout=5s.
+// Fields tagged `secret` are redacted by Print, fields tagged `reload` are applied by Merge while running.
 type Config struct {
-	DBConfig         DBConfig
-	ServerConfig     ServerConfig
-	HTTPClientConfig HTTPClientConfig
+	DBConfig         DBConfig         `yaml:"db"`
+	ServerConfig     ServerConfig     `yaml:"server"`
+	HandlerConfig    HandlerConfig    `yaml:"handler"`
+	AuthConfig       AuthConfig       `yaml:"auth"`
+	GRPCConfig       GRPCConfig       `yaml:"grpc"`
+	HTTPClientConfig HTTPClientConfig `yaml:"http_client"`
+	TenantConfig     TenantConfig     `yaml:"tenant"`
+	DuplicatesConfig DuplicatesConfig `yaml:"duplicates"`
+	RateLimitConfig  RateLimitConfig  `yaml:"rate_limit"`
+	TracingConfig    TracingConfig    `yaml:"tracing"`
+	LoggerConfig     LoggerConfig     `yaml:"log"`
+	ReloadConfig     ReloadConfig     `yaml:"reload"`
+
+	// Files are paths of existing files config was read from.
+	Files []string `yaml:"-"`
 }
 
 type DBConfig struct {
-	URL string
+	URL string `yaml:"url" env:"DATABASE_URL" secret:"true"`
+	// MigrateOnStart applies pending migrations before servers are started.
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+
+	// Pool is stdlib for database/sql pool or pgxpool for native pgx pool.
+	Pool            string        `yaml:"pool" env:"DB_POOL" default:"stdlib"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"25"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+	// StatementCacheMode is pgx query exec mode, simple_protocol or exec work behind pgbouncer
+	// in transaction mode.
+	StatementCacheMode string `yaml:"statement_cache_mode" env:"DB_STATEMENT_CACHE_MODE" default:"cache_statement"`
+	// ConnectTimeout is how long connecting on start is retried, ConnectBackoff is the first delay
+	// between attempts, it doubles after every attempt.
+	ConnectTimeout time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT" default:"30s"`
+	ConnectBackoff time.Duration `yaml:"connect_backoff" env:"DB_CONNECT_BACKOFF" default:"250ms"`
+
+	// TxIsolation is isolation level of transactions spanning several storage calls, TxMaxRetries
+	// is how many times transaction is retried after serialization failure or deadlock.
+	TxIsolation  string `yaml:"tx_isolation" env:"DB_TX_ISOLATION" default:"read_committed"`
+	TxMaxRetries int    `yaml:"tx_max_retries" env:"DB_TX_MAX_RETRIES" default:"3"`
+
+	// ReplicaURLs are comma separated urls of read replicas, pools to them are configured as to primary.
+	ReplicaURLs string `yaml:"replica_urls" env:"DB_REPLICA_URLS" secret:"true"`
+	// ReplicaMaxLag is replication lag above which replica is removed from rotation.
+	ReplicaMaxLag        time.Duration `yaml:"replica_max_lag" env:"DB_REPLICA_MAX_LAG" default:"10s"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" env:"DB_REPLICA_CHECK_INTERVAL" default:"5s"`
 }
 
 type ServerConfig struct {
-	Port         string
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
+	Port         string        `yaml:"port" env:"SERVER_PORT" default:"8080"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" default:"10s"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"10s"`
+	// ReadHeaderTimeout bounds reading of request headers, so that slow clients can't hold connections.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" default:"5s"`
+	// IdleTimeout is how long keep-alive connection waits for the next request.
+	IdleTimeout    time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"2m"`
+	MaxHeaderBytes int           `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES" default:"1048576"`
+	// H2C turns on HTTP/2 without TLS, https always supports HTTP/2.
+	H2C bool `yaml:"h2c" env:"SERVER_H2C"`
+	// DrainDelay is time between failing readiness on shutdown signal and stopping servers,
+	// so that load balancer stops routing requests to the instance.
+	DrainDelay time.Duration `yaml:"drain_delay" env:"SHUTDOWN_DRAIN_DELAY" default:"0s"`
+	// ShutdownTimeout is time every component is given to stop.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"5s"`
+
+	// TLSCertFile and TLSKeyFile turn on https, files are reloaded when they change.
+	TLSCertFile string `yaml:"tls_cert_file" env:"SERVER_TLS_CERT_FILE"`
+	TLSKeyFile  string `yaml:"tls_key_file" env:"SERVER_TLS_KEY_FILE"`
+	// TLSMinVersion is 1.2 or 1.3.
+	TLSMinVersion string `yaml:"tls_min_version" env:"SERVER_TLS_MIN_VERSION" default:"1.2"`
+	// TLSClientCAFile turns on mutual TLS, clients with certificates issued by the CA are authenticated by them.
+	TLSClientCAFile string `yaml:"tls_client_ca_file" env:"SERVER_TLS_CLIENT_CA_FILE"`
+	// TLSClientAuth is optional, which lets clients without certificate use bearer tokens, or require.
+	TLSClientAuth string `yaml:"tls_client_auth" env:"SERVER_TLS_CLIENT_AUTH" default:"optional"`
+}
+
+type HandlerConfig struct {
+	ValidateRequests bool `yaml:"validate_requests" env:"VALIDATE_REQUESTS" reload:"true"`
+	AuthEnabled      bool `yaml:"auth_enabled" env:"AUTH_ENABLED" default:"true"`
+	RateLimitEnabled bool `yaml:"rate_limit_enabled" env:"RATE_LIMIT_ENABLED" reload:"true"`
+	// MaxBodyBytes limits request bodies, some routes have lower limits.
+	MaxBodyBytes int `yaml:"max_body_bytes" env:"MAX_BODY_BYTES" default:"1048576"`
+	// MaxConcurrentRequests is number of api requests served at once, requests above it are rejected
+	// with 503. Zero means no limit.
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests" env:"MAX_CONCURRENT_REQUESTS" default:"1000"`
+	// IdempotencyTTL is how long responses to requests with Idempotency-Key are replayed.
+	IdempotencyTTL             time.Duration `yaml:"idempotency_ttl" env:"IDEMPOTENCY_TTL" default:"24h"`
+	IdempotencyCleanupInterval time.Duration `yaml:"idempotency_cleanup_interval" env:"IDEMPOTENCY_CLEANUP_INTERVAL" default:"1h"`
+}
+
+type AuthConfig struct {
+	BootstrapKey string `yaml:"bootstrap_key" env:"AUTH_BOOTSTRAP_KEY" secret:"true"`
+
+	JWKSFile            string        `yaml:"jwks_file" env:"JWKS_FILE"`
+	JWKSURL             string        `yaml:"jwks_url" env:"JWKS_URL"`
+	JWKSRefreshInterval time.Duration `yaml:"jwks_refresh_interval" env:"JWKS_REFRESH_INTERVAL" default:"5m"`
+	JWTIssuer           string        `yaml:"jwt_issuer" env:"JWT_ISSUER"`
+	JWTAudience         string        `yaml:"jwt_audience" env:"JWT_AUDIENCE"`
+	JWTClockSkew        time.Duration `yaml:"jwt_clock_skew" env:"JWT_CLOCK_SKEW" default:"30s"`
+	JWTScopesClaim      string        `yaml:"jwt_scopes_claim" env:"JWT_SCOPES_CLAIM"`
+	JWTTenantClaim      string        `yaml:"jwt_tenant_claim" env:"JWT_TENANT_CLAIM"`
+}
+
+type GRPCConfig struct {
+	Port string `yaml:"port" env:"GRPC_PORT" default:"9090"`
+}
+
+type TenantConfig struct {
+	// RLSEnabled makes storage set app.tenant_id for row level security policy of persons.
+	RLSEnabled bool `yaml:"rls_enabled" env:"TENANT_RLS_ENABLED"`
+	// DefaultQuota limits number of persons of every tenant, zero means unlimited.
+	DefaultQuota int            `yaml:"default_quota" env:"TENANT_DEFAULT_QUOTA"`
+	Quotas       map[string]int `yaml:"quotas" env:"TENANT_QUOTAS"`
+}
+
+type DuplicatesConfig struct {
+	// Policy is applied on create to persons with the same normalized name: allow, reject or
+	// return_existing. The last two can't be used with repeatable_read transactions.
+	Policy string `yaml:"policy" env:"DUPLICATE_POLICY" default:"allow"`
+	// Similarity is the lowest trigram similarity of names reported as duplicates.
+	Similarity float64 `yaml:"similarity" env:"DUPLICATE_SIMILARITY" default:"0.6"`
+}
+
+type RateLimitConfig struct {
+	// Backend is either memory or postgres, which shares limits between replicas.
+	Backend         string        `yaml:"backend" env:"RATE_LIMIT_BACKEND" default:"memory"`
+	ReadPerMinute   int           `yaml:"read_per_minute" env:"RATE_LIMIT_READ_PER_MINUTE" default:"600" reload:"true"`
+	ReadBurst       int           `yaml:"read_burst" env:"RATE_LIMIT_READ_BURST" default:"100" reload:"true"`
+	WritePerMinute  int           `yaml:"write_per_minute" env:"RATE_LIMIT_WRITE_PER_MINUTE" default:"60" reload:"true"`
+	WriteBurst      int           `yaml:"write_burst" env:"RATE_LIMIT_WRITE_BURST" default:"10" reload:"true"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env:"RATE_LIMIT_CLEANUP_INTERVAL" default:"10m"`
+}
+
+type LoggerConfig struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" default:"info" reload:"true"`
+	// Format is json or text.
+	Format string `yaml:"format" env:"LOG_FORMAT" default:"json"`
+	// Output is stdout, stderr or path to file.
+	Output string `yaml:"output" env:"LOG_OUTPUT" default:"stdout"`
+	// SamplingInitial records with the same message are logged every second, then every SamplingThereafter-th.
+	// Zero disables sampling.
+	SamplingInitial    int `yaml:"sampling_initial" env:"LOG_SAMPLING_INITIAL"`
+	SamplingThereafter int `yaml:"sampling_thereafter" env:"LOG_SAMPLING_THEREAFTER"`
+	// PII enables logging of personal data, such as names of persons.
+	PII bool `yaml:"pii" env:"LOG_PII"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout or otlp.
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" default:"none"`
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME" default:"effective_mobile"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" default:"1"`
 }
 
 type HTTPClientConfig struct {
-	AgeBaseURL         string
-	GenderBaseURL      string
-	NationalityBaseURL string
+	AgeBaseURL         string `yaml:"age_base_url" env:"AGE_BASE_URL" default:"https://api.agify.io" reload:"true"`
+	GenderBaseURL      string `yaml:"gender_base_url" env:"GENDER_BASE_URL" default:"https://api.genderize.io" reload:"true"`
+	NationalityBaseURL string `yaml:"nationality_base_url" env:"NATIONALITY_BASE_URL" default:"https://api.nationalize.io" reload:"true"`
+	// QuotaMode is what to do when only QuotaReserve requests are left in quota of an api:
+	// queue requests until quota is reset, or degrade and save persons without the data.
+	QuotaMode    string `yaml:"quota_mode" env:"QUOTA_MODE" default:"queue"`
+	QuotaReserve int    `yaml:"quota_reserve" env:"QUOTA_RESERVE" default:"5"`
 }
 
-func Init(path string) (*Config, error) {
-	err := godotenv.Load(path)
+type ReloadConfig struct {
+	// Watch reloads config when any of its files changes, besides SIGHUP.
+	Watch bool `yaml:"watch" env:"CONFIG_WATCH"`
+}
+
+// Load reads config with flags from args, which are command line arguments without program name.
+// Arguments left after flags, such as subcommands, are returned. Every invalid setting is reported
+// in returned error, not just the first one.
+func Load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("effective_mobile", flag.ContinueOnError)
+	envPath := fs.String("conf-path", "./config/.env", "path to optional .env file")
+	yamlPath := fs.String("config", "", "path to YAML config file, CONFIG_FILE by default")
+
+	conf := &Config{}
+	fields := configFields(conf)
+	flagValues := registerFlags(fs, fields)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	env, err := newEnv(*envPath, fields)
 	if err != nil {
-		return nil, fmt.Errorf("invalid path: %s", path)
+		return nil, nil, err
+	}
+	if env.dotenv != nil {
+		conf.Files = append(conf.Files, *envPath)
 	}
 
-	dburl := os.Getenv("DATABASE_URL")
-	if dburl == "" {
-		return nil, errors.New("db url is empty")
+	if *yamlPath == "" {
+		*yamlPath, _ = env.lookup("CONFIG_FILE")
 	}
 
-	srvport := os.Getenv("SERVER_PORT")
-	if srvport == "" {
-		return nil, errors.New("server port is empty")
+	for _, f := range fields {
+		if err = f.setDefault(); err != nil {
+			// defaults are static, so it can only be broken by a programming error
+			panic(err.Error())
+		}
 	}
 
-	readTimeout, err := strconv.Atoi(os.Getenv("SERVER_READ_TIMEOUT"))
+	var errs []error
+
+	if *yamlPath != "" {
+		conf.Files = append(conf.Files, *yamlPath)
+		if err = loadYAML(*yamlPath, conf); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, f := range fields {
+		if v, ok := env.lookup(f.env); ok && f.env != "" {
+			if err = f.set(v); err != nil {
+				errs = append(errs, fmt.Errorf("env %s: %w", f.env, err))
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if v, ok := flagValues[f.flagName()]; ok && v.isSet {
+			if err = f.set(v.raw); err != nil {
+				errs = append(errs, fmt.Errorf("flag -%s: %w", f.flagName(), err))
+			}
+		}
+	}
+
+	errs = append(errs, conf.validate()...)
+	if len(errs) != 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	return conf, fs.Args(), nil
+}
+
+// env looks variables up in environment and then in .env file. The file is read on every Load,
+// so that changes are picked up on reload.
+type env struct {
+	dotenv map[string]string
+}
+
+func newEnv(path string, fields []field) (*env, error) {
+	dotenv, err := godotenv.Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &env{}, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("invalid read timeout: %w", err)
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+
+	configEnv := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		configEnv[f.env] = true
+	}
+
+	// variables not used by config, such as OTEL_EXPORTER_OTLP_ENDPOINT, are exported for libraries
+	for key, value := range dotenv {
+		if _, ok := os.LookupEnv(key); !ok && !configEnv[key] {
+			_ = os.Setenv(key, value)
+		}
 	}
 
-	writeTimeout, err := strconv.Atoi(os.Getenv("SERVER_WRITE_TIMEOUT"))
+	return &env{dotenv: dotenv}, nil
+}
+
+// lookup returns variable set in environment, which takes precedence over .env file.
+func (e *env) lookup(key string) (string, bool) {
+	if v, ok := os.LookupEnv(key); ok {
+		return v, true
+	}
+
+	v, ok := e.dotenv[key]
+	return v, ok
+}
+
+func loadYAML(path string, conf *Config) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("invalid write timeout: %w", err)
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	if err = dec.Decode(conf); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
 	}
 
-	ageURL := os.Getenv("AGE_BASE_URL")
-	if ageURL == "" {
-		return nil, errors.New("age api URL is empty")
+	return nil
+}
+
+// Print writes effective config as YAML with secrets redacted.
+func Print(w io.Writer, conf *Config) error {
+	redacted := *conf
+	for _, f := range configFields(&redacted) {
+		f.redact()
 	}
 
-	genderURL := os.Getenv("GENDER_BASE_URL")
-	if genderURL == "" {
-		return nil, errors.New("gender api URL is empty")
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(&redacted); err != nil {
+		return err
 	}
 
-	nationalityURL := os.Getenv("NATIONALITY_BASE_URL")
-	if nationalityURL == "" {
-		return nil, errors.New("nationality api URL is empty")
+	return enc.Close()
+}
+
+// Merge returns cur with reloadable settings taken from next. Keys of other settings which differ
+// in next are returned, they are left as in cur, as they can't be changed without restart.
+func Merge(cur, next *Config) (*Config, []string) {
+	merged := *cur
+	merged.Files = next.Files
+
+	curFields, nextFields := configFields(cur), configFields(next)
+	mergedFields := configFields(&merged)
+
+	var rejected []string
+	for i := range mergedFields {
+		if reflect.DeepEqual(curFields[i].value.Interface(), nextFields[i].value.Interface()) {
+			continue
+		}
+
+		if !mergedFields[i].reload {
+			rejected = append(rejected, mergedFields[i].key)
+			continue
+		}
+
+		mergedFields[i].value.Set(nextFields[i].value)
 	}
 
-	return &Config{
-		DBConfig: DBConfig{
-			URL: dburl,
-		},
-		ServerConfig: ServerConfig{
-			Port:         srvport,
-			ReadTimeout:  time.Duration(readTimeout),
-			WriteTimeout: time.Duration(writeTimeout),
-		},
-		HTTPClientConfig: HTTPClientConfig{
-			AgeBaseURL:         ageURL,
-			GenderBaseURL:      genderURL,
-			NationalityBaseURL: nationalityURL,
-		},
-	}, nil
+	return &merged, rejected
 }
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+)
+
+const redacted = "[REDACTED]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is a setting of config, key is its path in YAML file, e.g. server.read_timeout.
+type field struct {
+	key    string
+	env    string
+	def    string
+	secret bool
+	reload bool
+	value  reflect.Value
+}
+
+// configFields returns settings of conf in order of declaration, values point into conf.
+func configFields(conf *Config) []field {
+	var fields []field
+
+	sections := reflect.ValueOf(conf).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionKey := sections.Type().Field(i).Tag.Get("yaml")
+		if sectionKey == "-" {
+			continue
+		}
+
+		for j := 0; j < section.NumField(); j++ {
+			sf := section.Type().Field(j)
+			fields = append(fields, field{
+				key:    sectionKey + "." + sf.Tag.Get("yaml"),
+				env:    sf.Tag.Get("env"),
+				def:    sf.Tag.Get("default"),
+				secret: sf.Tag.Get("secret") == "true",
+				reload: sf.Tag.Get("reload") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+
+	return fields
+}
+
+// flagName is key with dashes, e.g. server.read-timeout.
+func (f *field) flagName() string {
+	return strings.ReplaceAll(f.key, "_", "-")
+}
+
+func (f *field) setDefault() error {
+	if f.def == "" {
+		return nil
+	}
+
+	if err := f.set(f.def); err != nil {
+		return fmt.Errorf("invalid default of %s: %w", f.key, err)
+	}
+
+	return nil
+}
+
+// set parses raw as it is written in env or flag. Durations are Go duration strings, plain integers
+// are seconds, as it was before durations were supported. Maps are in key=value,key=value format.
+func (f *field) set(raw string) error {
+	v := f.value
+
+	if v.Type() == durationType {
+		if seconds, err := strconv.Atoi(raw); err == nil {
+			v.SetInt(int64(time.Duration(seconds) * time.Second))
+			return nil
+		}
+
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(i))
+	case reflect.Float64:
+		fl, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(fl)
+	case reflect.Map:
+		// the only map is tenant quotas
+		quotas, err := tenant.ParseQuotas(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(quotas))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func (f *field) redact() {
+	if f.secret && f.value.String() != "" {
+		f.value.SetString(redacted)
+	}
+}
+
+// flagValue keeps raw value of flag, it is parsed after lower layers are applied.
+type flagValue struct {
+	raw    string
+	isSet  bool
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	return v.raw
+}
+
+func (v *flagValue) Set(raw string) error {
+	v.raw, v.isSet = raw, true
+	return nil
+}
+
+// IsBoolFlag allows boolean flags to be set without value, e.g. -log.pii.
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+func registerFlags(fs *flag.FlagSet, fields []field) map[string]*flagValue {
+	values := make(map[string]*flagValue, len(fields))
+
+	for i := range fields {
+		f := &fields[i]
+		v := &flagValue{isBool: f.value.Kind() == reflect.Bool}
+		values[f.flagName()] = v
+
+		usage := f.key
+		if f.env != "" {
+			usage += ", env " + f.env
+		}
+		if f.def != "" {
+			usage += ", default " + f.def
+		}
+		fs.Var(v, f.flagName(), usage)
+	}
+
+	return values
+}
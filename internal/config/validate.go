@@ -0,0 +1,151 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+)
+
+// validate returns every problem of conf, errors name settings by their YAML keys.
+func (c *Config) validate() []error {
+	var v validator
+
+	v.required("db.url", c.DBConfig.URL)
+	v.oneOf("db.pool", c.DBConfig.Pool, DBPoolStdlib, DBPoolPgxpool)
+	v.positive("db.max_open_conns", int64(c.DBConfig.MaxOpenConns))
+	v.nonNegative("db.max_idle_conns", int64(c.DBConfig.MaxIdleConns))
+	v.nonNegative("db.conn_max_lifetime", int64(c.DBConfig.ConnMaxLifetime))
+	v.nonNegative("db.conn_max_idle_time", int64(c.DBConfig.ConnMaxIdleTime))
+	v.oneOf("db.statement_cache_mode", c.DBConfig.StatementCacheMode,
+		"cache_statement", "cache_describe", "describe_exec", "exec", "simple_protocol")
+	v.nonNegative("db.connect_timeout", int64(c.DBConfig.ConnectTimeout))
+	v.positive("db.connect_backoff", int64(c.DBConfig.ConnectBackoff))
+	v.oneOf("db.tx_isolation", c.DBConfig.TxIsolation,
+		TxIsolationReadCommitted, TxIsolationRepeatableRead, TxIsolationSerializable)
+	v.nonNegative("db.tx_max_retries", int64(c.DBConfig.TxMaxRetries))
+	v.positive("db.replica_max_lag", int64(c.DBConfig.ReplicaMaxLag))
+	v.positive("db.replica_check_interval", int64(c.DBConfig.ReplicaCheckInterval))
+
+	v.required("server.port", c.ServerConfig.Port)
+	v.nonNegative("server.read_timeout", int64(c.ServerConfig.ReadTimeout))
+	v.nonNegative("server.write_timeout", int64(c.ServerConfig.WriteTimeout))
+	v.nonNegative("server.read_header_timeout", int64(c.ServerConfig.ReadHeaderTimeout))
+	v.nonNegative("server.idle_timeout", int64(c.ServerConfig.IdleTimeout))
+	v.positive("server.max_header_bytes", int64(c.ServerConfig.MaxHeaderBytes))
+	v.nonNegative("server.drain_delay", int64(c.ServerConfig.DrainDelay))
+	v.positive("server.shutdown_timeout", int64(c.ServerConfig.ShutdownTimeout))
+	if (c.ServerConfig.TLSCertFile == "") != (c.ServerConfig.TLSKeyFile == "") {
+		v.add("server.tls_cert_file", "must be set together with server.tls_key_file")
+	}
+	if c.ServerConfig.TLSClientCAFile != "" && c.ServerConfig.TLSCertFile == "" {
+		v.add("server.tls_client_ca_file", "requires server.tls_cert_file")
+	}
+	v.oneOf("server.tls_min_version", c.ServerConfig.TLSMinVersion, "1.2", "1.3")
+	v.oneOf("server.tls_client_auth", c.ServerConfig.TLSClientAuth, TLSClientAuthOptional, TLSClientAuthRequire)
+
+	v.positive("handler.max_body_bytes", int64(c.HandlerConfig.MaxBodyBytes))
+	v.nonNegative("handler.max_concurrent_requests", int64(c.HandlerConfig.MaxConcurrentRequests))
+	v.positive("handler.idempotency_ttl", int64(c.HandlerConfig.IdempotencyTTL))
+	v.positive("handler.idempotency_cleanup_interval", int64(c.HandlerConfig.IdempotencyCleanupInterval))
+
+	v.nonNegative("auth.jwks_refresh_interval", int64(c.AuthConfig.JWKSRefreshInterval))
+	v.nonNegative("auth.jwt_clock_skew", int64(c.AuthConfig.JWTClockSkew))
+	if c.AuthConfig.JWKSURL != "" {
+		v.url("auth.jwks_url", c.AuthConfig.JWKSURL)
+	}
+
+	v.required("grpc.port", c.GRPCConfig.Port)
+
+	v.url("http_client.age_base_url", c.HTTPClientConfig.AgeBaseURL)
+	v.url("http_client.gender_base_url", c.HTTPClientConfig.GenderBaseURL)
+	v.url("http_client.nationality_base_url", c.HTTPClientConfig.NationalityBaseURL)
+	v.oneOf("http_client.quota_mode", c.HTTPClientConfig.QuotaMode, QuotaModeQueue, QuotaModeDegrade)
+	v.nonNegative("http_client.quota_reserve", int64(c.HTTPClientConfig.QuotaReserve))
+
+	v.nonNegative("tenant.default_quota", int64(c.TenantConfig.DefaultQuota))
+	for id, quota := range c.TenantConfig.Quotas {
+		if err := tenant.ValidateID(id); err != nil {
+			v.add("tenant.quotas", err.Error())
+		}
+		v.nonNegative("tenant.quotas."+id, int64(quota))
+	}
+
+	v.oneOf("duplicates.policy", c.DuplicatesConfig.Policy,
+		DuplicatePolicyAllow, DuplicatePolicyReject, DuplicatePolicyReturnExisting)
+	// repeatable read transaction takes snapshot before duplicate lock is acquired, so it can't see
+	// person inserted by concurrent create, while serializable one fails and is retried
+	if c.DuplicatesConfig.Policy != DuplicatePolicyAllow && c.DBConfig.TxIsolation == TxIsolationRepeatableRead {
+		v.add("duplicates.policy", fmt.Sprintf("%q requires db.tx_isolation %s or %s",
+			c.DuplicatesConfig.Policy, TxIsolationReadCommitted, TxIsolationSerializable))
+	}
+	if c.DuplicatesConfig.Similarity <= 0 || c.DuplicatesConfig.Similarity > 1 {
+		v.add("duplicates.similarity", "must be greater than 0 and at most 1")
+	}
+
+	v.oneOf("rate_limit.backend", c.RateLimitConfig.Backend, RateLimitBackendMemory, RateLimitBackendPostgres)
+	v.positive("rate_limit.read_per_minute", int64(c.RateLimitConfig.ReadPerMinute))
+	v.positive("rate_limit.read_burst", int64(c.RateLimitConfig.ReadBurst))
+	v.positive("rate_limit.write_per_minute", int64(c.RateLimitConfig.WritePerMinute))
+	v.positive("rate_limit.write_burst", int64(c.RateLimitConfig.WriteBurst))
+	v.nonNegative("rate_limit.cleanup_interval", int64(c.RateLimitConfig.CleanupInterval))
+
+	v.oneOf("tracing.exporter", c.TracingConfig.Exporter, "none", "stdout", "otlp")
+	if c.TracingConfig.SampleRatio < 0 || c.TracingConfig.SampleRatio > 1 {
+		v.add("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LoggerConfig.Level)); err != nil {
+		v.add("log.level", fmt.Sprintf("%q is not one of debug, info, warn, error", c.LoggerConfig.Level))
+	}
+	v.oneOf("log.format", c.LoggerConfig.Format, "json", "text")
+	v.required("log.output", c.LoggerConfig.Output)
+	v.nonNegative("log.sampling_initial", int64(c.LoggerConfig.SamplingInitial))
+	v.nonNegative("log.sampling_thereafter", int64(c.LoggerConfig.SamplingThereafter))
+
+	return v.errs
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(key, problem string) {
+	v.errs = append(v.errs, errors.New(key+": "+problem))
+}
+
+func (v *validator) required(key, value string) {
+	if value == "" {
+		v.add(key, "is required")
+	}
+}
+
+func (v *validator) positive(key string, value int64) {
+	if value <= 0 {
+		v.add(key, "must be positive")
+	}
+}
+
+func (v *validator) nonNegative(key string, value int64) {
+	if value < 0 {
+		v.add(key, "must not be negative")
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		v.add(key, fmt.Sprintf("%q is not one of %s", value, strings.Join(allowed, ", ")))
+	}
+}
+
+func (v *validator) url(key, value string) {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		v.add(key, fmt.Sprintf("%q is not an absolute url", value))
+	}
+}
@@ -0,0 +1,48 @@
+package grpchandlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/HeadGardener/effective_mobile/internal/client"
+	"github.com/HeadGardener/effective_mobile/internal/services"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newStatusErr logs err and converts it into grpc status, hiding details of unexpected errors
+// the same way handlers.newErrResponse does.
+func (h *Handler) newStatusErr(ctx context.Context, code codes.Code, msg string, err error) error {
+	h.log.ErrorContext(ctx, msg, "error", err.Error())
+
+	if code == codes.Internal {
+		code = codeFromErr(err)
+	}
+
+	if code == codes.Internal {
+		return status.Errorf(code, "%s: unexpected error", msg)
+	}
+
+	return status.Errorf(code, "%s: %s", msg, err.Error())
+}
+
+func codeFromErr(err error) codes.Code {
+	switch {
+	case errors.Is(err, services.ErrPersonNotExist), errors.Is(err, sql.ErrNoRows):
+		return codes.NotFound
+	case errors.Is(err, services.ErrPersonDuplicate):
+		return codes.AlreadyExists
+	case errors.Is(err, tenant.ErrQuotaExceeded):
+		return codes.ResourceExhausted
+	case errors.Is(err, client.ErrQuotaExhausted):
+		return codes.Unavailable
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,63 @@
+package grpchandlers
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	personv1 "github.com/HeadGardener/effective_mobile/pkg/api/person/v1"
+	"google.golang.org/grpc"
+)
+
+const (
+	createdAtLayout = "2006-01-02 15:04:05.000000"
+
+	defaultListPageSize = 100
+	maxListPageSize     = 1000
+)
+
+type PersonService interface {
+	Create(ctx context.Context, person *models.Person) (string, bool, error)
+	Get(ctx context.Context, filters map[string]any, id, createdAt string, limit int, order models.Order) ([]models.Person, error)
+	GetByID(ctx context.Context, id string) (*models.Person, error)
+	Delete(ctx context.Context, id string) (*models.Person, error)
+	Update(ctx context.Context, id string, fields map[string]any) (*models.Person, error)
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+type Handler struct {
+	personv1.UnimplementedPersonServiceServer
+
+	log *slog.Logger
+
+	authEnabled bool
+
+	personService PersonService
+	authenticator Authenticator
+}
+
+func NewHandler(conf config.HandlerConfig, log *slog.Logger,
+	personService PersonService, authenticator Authenticator) *Handler {
+	return &Handler{
+		log:           log,
+		authEnabled:   conf.AuthEnabled,
+		personService: personService,
+		authenticator: authenticator,
+	}
+}
+
+func (h *Handler) InitServer(opts ...grpc.ServerOption) *grpc.Server {
+	srv := grpc.NewServer(append(opts,
+		grpc.ChainUnaryInterceptor(h.recoverUnary, h.logUnary, h.authUnary),
+		grpc.ChainStreamInterceptor(h.recoverStream, h.logStream, h.authStream),
+	)...)
+
+	personv1.RegisterPersonServiceServer(srv, h)
+
+	return srv
+}
@@ -0,0 +1,189 @@
+package grpchandlers
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/logger"
+	"github.com/HeadGardener/effective_mobile/internal/services"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+	personv1 "github.com/HeadGardener/effective_mobile/pkg/api/person/v1"
+)
+
+const (
+	requestIDMetadata     = "x-request-id"
+	authorizationMetadata = "authorization"
+	bearerPrefix          = "Bearer "
+)
+
+func (h *Handler) logUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (any, error) {
+	ctx = withRequestID(ctx)
+	h.log.InfoContext(ctx, "got grpc request", "method", info.FullMethod)
+
+	resp, err := handler(ctx, req)
+	h.log.InfoContext(ctx, "sending grpc response", "method", info.FullMethod, "code", status.Code(err).String())
+
+	return resp, err
+}
+
+func (h *Handler) logStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	ctx := withRequestID(ss.Context())
+	h.log.InfoContext(ctx, "got grpc stream", "method", info.FullMethod)
+
+	err := handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+	h.log.InfoContext(ctx, "closing grpc stream", "method", info.FullMethod, "code", status.Code(err).String())
+
+	return err
+}
+
+// withRequestID puts request id from x-request-id metadata, or a new one, into context for logger.
+func withRequestID(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadata); len(values) != 0 && values[0] != "" {
+			return logger.WithRequestID(ctx, values[0])
+		}
+	}
+
+	return logger.WithRequestID(ctx, uuid.NewString())
+}
+
+func (h *Handler) recoverUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			h.log.ErrorContext(ctx, "panic while handling grpc request", "method", info.FullMethod, "panic", p)
+			err = status.Error(codes.Internal, "unexpected error")
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+func (h *Handler) recoverStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			h.log.ErrorContext(ss.Context(), "panic while handling grpc stream", "method", info.FullMethod, "panic", p)
+			err = status.Error(codes.Internal, "unexpected error")
+		}
+	}()
+
+	return handler(srv, ss)
+}
+
+// methodScopes maps full rpc method names onto scopes required to call them.
+var methodScopes = map[string]auth.Scope{
+	personv1.PersonService_Create_FullMethodName:  auth.ScopePersonsWrite,
+	personv1.PersonService_Get_FullMethodName:     auth.ScopePersonsRead,
+	personv1.PersonService_GetByID_FullMethodName: auth.ScopePersonsRead,
+	personv1.PersonService_Update_FullMethodName:  auth.ScopePersonsWrite,
+	personv1.PersonService_Delete_FullMethodName:  auth.ScopePersonsDelete,
+	personv1.PersonService_List_FullMethodName:    auth.ScopePersonsRead,
+}
+
+func (h *Handler) authUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (any, error) {
+	ctx, err := h.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (h *Handler) authStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	ctx, err := h.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authorize authenticates bearer api key or JWT from "authorization" metadata, or client certificate verified by
+// mutual TLS if there is no token, and checks scope of the method.
+func (h *Handler) authorize(ctx context.Context, method string) (context.Context, error) {
+	if !h.authEnabled {
+		return ctx, nil
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(authorizationMetadata); len(values) != 0 {
+			token, _ = strings.CutPrefix(values[0], bearerPrefix)
+		}
+	}
+
+	var (
+		principal *auth.Principal
+		err       error
+	)
+
+	cert := clientCertificate(ctx)
+	switch {
+	case token != "":
+		principal, err = h.authenticator.Authenticate(ctx, token)
+	case cert != nil:
+		principal, err = auth.PrincipalFromCertificate(cert)
+	default:
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) || errors.Is(err, auth.ErrInvalidToken) ||
+			errors.Is(err, auth.ErrInvalidCertificate) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil, h.newStatusErr(ctx, codes.Internal, "failed while authenticating request", err)
+	}
+
+	scope, ok := methodScopes[method]
+	if !ok {
+		scope = auth.ScopeAdmin
+	}
+
+	if !principal.HasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "missing scope: %s", scope)
+	}
+
+	return tenant.WithID(auth.WithPrincipal(ctx, principal), principal.TenantID), nil
+}
+
+// clientCertificate returns client certificate verified by mutual TLS, if any.
+func clientCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 {
+		return nil
+	}
+
+	return info.State.VerifiedChains[0][0]
+}
+
+// wrappedStream replaces context of stream with one enriched by interceptors.
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *wrappedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,283 @@
+package grpchandlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	personv1 "github.com/HeadGardener/effective_mobile/pkg/api/person/v1"
+)
+
+var (
+	letterRegexp = regexp.MustCompile(`[A-z]$`)
+)
+
+func (h *Handler) Create(ctx context.Context, req *personv1.CreateRequest) (*personv1.CreateResponse, error) {
+	if err := validateCreateRequest(req); err != nil {
+		return nil, h.newStatusErr(ctx, codes.InvalidArgument, "failed while validating create person req", err)
+	}
+
+	person := &models.Person{
+		Name:       req.GetName(),
+		Surname:    req.GetSurname(),
+		Patronymic: req.GetPatronymic(),
+	}
+
+	id, _, err := h.personService.Create(ctx, person)
+	if err != nil {
+		return nil, h.newStatusErr(ctx, codes.Internal, "failed while creating person", err)
+	}
+
+	return &personv1.CreateResponse{Id: id}, nil
+}
+
+func (h *Handler) Get(ctx context.Context, req *personv1.GetRequest) (*personv1.GetResponse, error) {
+	if err := validatePersonIDAndCreatedAt(req.GetPersonId(), req.GetCreatedAt()); err != nil {
+		return nil, h.newStatusErr(ctx, codes.InvalidArgument, "failed while validation request", err)
+	}
+
+	if req.GetLimit() <= 0 {
+		return nil, h.newStatusErr(ctx, codes.InvalidArgument, "invalid limit value",
+			errors.New("limit must be greater than 0"))
+	}
+
+	persons, err := h.personService.Get(ctx, filtersToMap(req.GetFilters()),
+		req.GetPersonId(), req.GetCreatedAt(), int(req.GetLimit()), models.OrderDesc)
+	if err != nil {
+		return nil, h.newStatusErr(ctx, codes.Internal, "failed while getting persons", err)
+	}
+
+	resp := &personv1.GetResponse{
+		Persons: make([]*personv1.Person, 0, len(persons)),
+	}
+	for i := range persons {
+		resp.Persons = append(resp.Persons, toProto(&persons[i]))
+	}
+
+	return resp, nil
+}
+
+func (h *Handler) GetByID(ctx context.Context, req *personv1.GetByIDRequest) (*personv1.Person, error) {
+	if _, err := uuid.Parse(req.GetId()); err != nil {
+		return nil, h.newStatusErr(ctx, codes.InvalidArgument, "invalid person id", err)
+	}
+
+	person, err := h.personService.GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, h.newStatusErr(ctx, codes.Internal, "failed while getting person", err)
+	}
+
+	return toProto(person), nil
+}
+
+func (h *Handler) Update(ctx context.Context, req *personv1.UpdateRequest) (*personv1.UpdateResponse, error) {
+	if _, err := uuid.Parse(req.GetId()); err != nil {
+		return nil, h.newStatusErr(ctx, codes.InvalidArgument, "invalid person id", err)
+	}
+
+	if err := validateUpdateRequest(req); err != nil {
+		return nil, h.newStatusErr(ctx, codes.InvalidArgument, "failed while validating update person req", err)
+	}
+
+	fields := updateRequestToMap(req)
+	if len(fields) == 0 {
+		return nil, h.newStatusErr(ctx, codes.InvalidArgument, "failed while validating update person req",
+			errors.New("nothing to update"))
+	}
+
+	person, err := h.personService.Update(ctx, req.GetId(), fields)
+	if err != nil {
+		return nil, h.newStatusErr(ctx, codes.Internal, "failed while updating person", err)
+	}
+
+	return &personv1.UpdateResponse{Status: "updated", Person: toProto(person)}, nil
+}
+
+func (h *Handler) Delete(ctx context.Context, req *personv1.DeleteRequest) (*personv1.DeleteResponse, error) {
+	if _, err := uuid.Parse(req.GetId()); err != nil {
+		return nil, h.newStatusErr(ctx, codes.InvalidArgument, "invalid person id", err)
+	}
+
+	person, err := h.personService.Delete(ctx, req.GetId())
+	if err != nil {
+		return nil, h.newStatusErr(ctx, codes.Internal, "failed while deleting person", err)
+	}
+
+	return &personv1.DeleteResponse{Status: "deleted", Person: toProto(person)}, nil
+}
+
+func (h *Handler) List(req *personv1.ListRequest, stream personv1.PersonService_ListServer) error {
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return h.newStatusErr(stream.Context(), codes.InvalidArgument, "invalid page size",
+			errors.New("page size can't be negative"))
+	case pageSize == 0:
+		pageSize = defaultListPageSize
+	case pageSize > maxListPageSize:
+		pageSize = maxListPageSize
+	}
+
+	filters := filtersToMap(req.GetFilters())
+
+	var id, createdAt string
+	for {
+		persons, err := h.personService.Get(stream.Context(), filters, id, createdAt, pageSize, models.OrderDesc)
+		if err != nil {
+			return h.newStatusErr(stream.Context(), codes.Internal, "failed while listing persons", err)
+		}
+
+		for i := range persons {
+			if err = stream.Send(toProto(&persons[i])); err != nil {
+				return err
+			}
+		}
+
+		if len(persons) < pageSize {
+			return nil
+		}
+
+		last := persons[len(persons)-1]
+		id, createdAt = last.ID, last.CreatedAt.Format(createdAtLayout)
+	}
+}
+
+func toProto(person *models.Person) *personv1.Person {
+	return &personv1.Person{
+		Id:          person.ID,
+		Name:        person.Name,
+		Surname:     person.Surname,
+		Patronymic:  person.Patronymic,
+		Age:         int32(person.Age),
+		Gender:      person.Gender,
+		Nationality: person.Nationality,
+		CreatedAt:   timestamppb.New(person.CreatedAt),
+	}
+}
+
+func filtersToMap(filters *personv1.Filters) map[string]any {
+	var m = make(map[string]any)
+
+	if filters == nil {
+		return m
+	}
+
+	if filters.Name != nil {
+		m["name"] = filters.GetName()
+	}
+
+	if filters.Surname != nil {
+		m["surname"] = filters.GetSurname()
+	}
+
+	if filters.Age != nil {
+		m["age"] = int(filters.GetAge())
+	}
+
+	if filters.Gender != nil {
+		m["gender"] = filters.GetGender()
+	}
+
+	if filters.Nationality != nil {
+		m["nationality"] = filters.GetNationality()
+	}
+
+	return m
+}
+
+func updateRequestToMap(req *personv1.UpdateRequest) map[string]any {
+	var m = make(map[string]any)
+
+	if req.Name != nil {
+		m["name"] = req.GetName()
+	}
+
+	if req.Surname != nil {
+		m["surname"] = req.GetSurname()
+	}
+
+	if req.Patronymic != nil {
+		m["patronymic"] = req.GetPatronymic()
+	}
+
+	if req.Age != nil {
+		m["age"] = int8(req.GetAge())
+	}
+
+	if req.Gender != nil {
+		m["gender"] = req.GetGender()
+	}
+
+	if req.Nationality != nil {
+		m["nationality"] = req.GetNationality()
+	}
+
+	return m
+}
+
+func validateCreateRequest(req *personv1.CreateRequest) error {
+	if (req.GetName() == "") || !letterRegexp.MatchString(req.GetName()) {
+		return errors.New("invalid name, it must contain only letters and can't be empty")
+	}
+
+	if (req.GetSurname() == "") || !letterRegexp.MatchString(req.GetSurname()) {
+		return errors.New("invalid surname, it must contain only letters and can't be empty")
+	}
+
+	if (req.GetPatronymic() != "") && !letterRegexp.MatchString(req.GetPatronymic()) {
+		return errors.New("invalid patronymic, it must contain only letters and can't be empty")
+	}
+
+	return nil
+}
+
+func validateUpdateRequest(req *personv1.UpdateRequest) error {
+	if (req.Name != nil) && (!letterRegexp.MatchString(req.GetName()) || (req.GetName() == "")) {
+		return errors.New("invalid name to update, it must contain only letters and can't be empty")
+	}
+
+	if (req.Surname != nil) && (!letterRegexp.MatchString(req.GetSurname()) || (req.GetSurname() == "")) {
+		return errors.New("invalid surname to update, it must contain only letters and can't be empty")
+	}
+
+	if (req.Patronymic != nil) && (!letterRegexp.MatchString(req.GetPatronymic()) || (req.GetPatronymic() == "")) {
+		return errors.New("invalid patronymic to update, it must contain only letters and can't be empty")
+	}
+
+	if (req.Age != nil) && (req.GetAge() < 0 || req.GetAge() > 120) {
+		return errors.New("invalid age, it must be greater than 0 and less than 120")
+	}
+
+	if (req.Gender != nil) && (!letterRegexp.MatchString(req.GetGender()) || (req.GetGender() == "")) {
+		return errors.New("invalid gender to update, it must contain only letters and it can't be empty")
+	}
+
+	if (req.Nationality != nil) && (!letterRegexp.MatchString(req.GetNationality()) || (req.GetNationality() == "")) {
+		return errors.New("invalid nationality to update, it must contain only letters and can't be empty")
+	}
+
+	return nil
+}
+
+func validatePersonIDAndCreatedAt(id, createdAt string) error {
+	if id != "" {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("invalid person_id: %w", err)
+		}
+	}
+
+	if createdAt != "" {
+		if _, err := time.Parse(createdAtLayout, createdAt); err != nil {
+			return fmt.Errorf("invalid created_at: %w", err)
+		}
+	}
+
+	return nil
+}
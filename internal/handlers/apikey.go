@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+)
+
+var errForeignTenant = errors.New("api keys of other tenants can be created only by super admin")
+
+type createAPIKeyReq struct {
+	Name   string       `json:"name"`
+	Scopes []auth.Scope `json:"scopes"`
+	// TenantID defaults to tenant of the caller, only super admin may set another one.
+	TenantID string `json:"tenant_id"`
+}
+
+type apiKeyResp struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	TenantID  string     `json:"tenant_id"`
+	Scopes    string     `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (h *Handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyReq
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.newErrResponse(w, r, statusFromBodyErr(err), "failed while decoding create api key req", err)
+		return
+	}
+
+	callerTenant := tenant.FromContext(r.Context())
+	if req.TenantID == "" {
+		req.TenantID = callerTenant
+	}
+
+	if req.TenantID != callerTenant && h.authEnabled && !auth.PrincipalFrom(r.Context()).IsSuperAdmin() {
+		h.newErrResponse(w, r, http.StatusForbidden, "failed while creating api key", errForeignTenant)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		h.newErrResponse(w, r, http.StatusBadRequest, "failed while validating create api key req", err)
+		return
+	}
+
+	plain, key, err := h.apiKeyService.Create(r.Context(), req.Name, req.TenantID, req.Scopes)
+	if err != nil {
+		h.newErrResponse(w, r, http.StatusInternalServerError, "failed while creating api key", err)
+		return
+	}
+
+	// plain key must not get into logs, so response is written bypassing newResponse
+	h.log.InfoContext(r.Context(), "sending response", "status", http.StatusCreated, "key_id", key.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"key":     plain,
+		"api_key": toAPIKeyResp(key),
+	})
+}
+
+func (h *Handler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeyService.List(r.Context())
+	if err != nil {
+		h.newErrResponse(w, r, http.StatusInternalServerError, "failed while listing api keys", err)
+		return
+	}
+
+	resp := make([]apiKeyResp, 0, len(keys))
+	for i := range keys {
+		resp = append(resp, toAPIKeyResp(&keys[i]))
+	}
+
+	h.newResponse(w, r, http.StatusOK, resp)
+}
+
+func (h *Handler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, apiKeyIDParam)
+
+	if _, err := uuid.Parse(id); err != nil {
+		h.newErrResponse(w, r, http.StatusBadRequest, "invalid api key id", err)
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(r.Context(), id); err != nil {
+		h.newErrResponse(w, r, statusFromErr(err), "failed while revoking api key", err)
+		return
+	}
+
+	h.newResponse(w, r, http.StatusOK, map[string]any{
+		"status": "revoked",
+	})
+}
+
+func (req *createAPIKeyReq) validate() error {
+	if req.Name == "" {
+		return errors.New("invalid name, it can't be empty")
+	}
+
+	if err := tenant.ValidateID(req.TenantID); err != nil {
+		return err
+	}
+
+	if len(req.Scopes) == 0 {
+		return errors.New("invalid scopes, at least one scope is required")
+	}
+
+	if _, err := auth.ParseScopes(auth.JoinScopes(req.Scopes)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func toAPIKeyResp(key *models.APIKey) apiKeyResp {
+	resp := apiKeyResp{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		TenantID:  key.TenantID,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+
+	if key.RevokedAt.Valid {
+		resp.RevokedAt = &key.RevokedAt.Time
+	}
+
+	return resp
+}
@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/handlers"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+)
+
+type apiKeyService struct {
+	handlers.APIKeyService
+}
+
+func (apiKeyService) Create(_ context.Context, name, tenantID string, scopes []auth.Scope) (string, *models.APIKey, error) {
+	return "plain-key", &models.APIKey{ID: "key-id", Name: name, TenantID: tenantID, Scopes: auth.JoinScopes(scopes)}, nil
+}
+
+func TestCreateAPIKeyRespondsWithJSON(t *testing.T) {
+	h := handlers.NewHandler(config.HandlerConfig{MaxBodyBytes: 1 << 20}, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		nil, apiKeyService{}, nil, nil, nil, nil, nil)
+
+	w := httptest.NewRecorder()
+	h.InitRoutes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/api-keys",
+		strings.NewReader(`{"name": "reporter", "scopes": ["persons:read"]}`)))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected json content type, got %q", ct)
+	}
+
+	var resp struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if resp.Key != "plain-key" {
+		t.Fatalf("expected plain key in response, got %q", resp.Key)
+	}
+}
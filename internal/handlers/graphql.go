@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+)
+
+const (
+	graphQLPath = "/graphql"
+
+	defaultPersonsFirst = 10
+	maxPersonsFirst     = 100
+
+	cursorLayout    = "2006-01-02 15:04:05.000000"
+	cursorSeparator = "|"
+)
+
+var (
+	errInvalidCursor = errors.New("invalid cursor")
+)
+
+type graphQLReq struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+func (h *Handler) graphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphQLReq
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.newErrResponse(w, r, statusFromBodyErr(err), "failed while decoding graphql req", err)
+		return
+	}
+
+	if err := checkQueryComplexity(req.Query, req.OperationName, req.Variables); err != nil {
+		h.log.ErrorContext(r.Context(), "graphql query rejected", "error", err.Error())
+		h.newResponse(w, r, http.StatusBadRequest, &graphql.Result{
+			Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError(err.Error())},
+		})
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.gqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+
+	h.newResponse(w, r, http.StatusOK, result)
+}
+
+// isGraphQLMutation reports whether graphql request body asks to execute mutation. Bodies which can't be
+// parsed, or don't name one operation of several, are treated as mutations, so that they are limited as writes.
+func isGraphQLMutation(body []byte) bool {
+	var req graphQLReq
+	if err := json.Unmarshal(body, &req); err != nil {
+		return true
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return true
+	}
+
+	var operations []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if ok && (req.OperationName == "" || (op.Name != nil && op.Name.Value == req.OperationName)) {
+			operations = append(operations, op)
+		}
+	}
+
+	return len(operations) != 1 || operations[0].Operation != ast.OperationTypeQuery
+}
+
+func newGraphQLSchema(h *Handler) (graphql.Schema, error) {
+	personType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Person",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"surname":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"patronymic":  &graphql.Field{Type: graphql.String},
+			"age":         &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"gender":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"nationality": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"createdAt":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		},
+	})
+
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PersonEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: graphql.NewNonNull(personType)},
+		},
+	})
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"endCursor":   &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PersonConnection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+		},
+	})
+
+	filterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "PersonFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			nameQuery:        &graphql.InputObjectFieldConfig{Type: graphql.String},
+			surnameQuery:     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			patronymicQuery:  &graphql.InputObjectFieldConfig{Type: graphql.String},
+			ageQuery:         &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			genderQuery:      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			nationalityQuery: &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	sortType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "PersonSort",
+		Values: graphql.EnumValueConfigMap{
+			"CREATED_AT_DESC": &graphql.EnumValueConfig{Value: models.OrderDesc},
+			"CREATED_AT_ASC":  &graphql.EnumValueConfig{Value: models.OrderAsc},
+		},
+	})
+
+	updateInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UpdatePersonInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"surname":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"patronymic":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"age":         &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"gender":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"nationality": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"persons": &graphql.Field{
+				Type: graphql.NewNonNull(connectionType),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: filterType},
+					"sort":   &graphql.ArgumentConfig{Type: sortType, DefaultValue: models.OrderDesc},
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPersonsFirst},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: h.resolvePersons,
+			},
+			"person": &graphql.Field{
+				Type: personType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: h.resolvePerson,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createPerson": &graphql.Field{
+				Type: graphql.NewNonNull(personType),
+				Args: graphql.FieldConfigArgument{
+					"name":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"surname":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"patronymic": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: h.resolveCreatePerson,
+			},
+			"updatePerson": &graphql.Field{
+				Type: graphql.NewNonNull(personType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateInputType)},
+				},
+				Resolve: h.resolveUpdatePerson,
+			},
+			"deletePerson": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: h.resolveDeletePerson,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
+
+type personConnection struct {
+	Edges    []personEdge
+	PageInfo pageInfo
+}
+
+type personEdge struct {
+	Cursor string
+	Node   models.Person
+}
+
+type pageInfo struct {
+	HasNextPage bool
+	EndCursor   *string
+}
+
+func (h *Handler) resolvePersons(p graphql.ResolveParams) (any, error) {
+	if err := h.checkScope(p.Context, auth.ScopePersonsRead); err != nil {
+		return nil, err
+	}
+
+	first, _ := p.Args["first"].(int)
+	if first <= 0 || first > maxPersonsFirst {
+		return nil, fmt.Errorf("first must be between 1 and %d", maxPersonsFirst)
+	}
+
+	order, _ := p.Args["sort"].(models.Order)
+
+	var id, createdAt string
+	if after, ok := p.Args["after"].(string); ok && after != "" {
+		var err error
+		if id, createdAt, err = decodeCursor(after); err != nil {
+			return nil, err
+		}
+	}
+
+	filters := make(map[string]any)
+	if filter, ok := p.Args["filter"].(map[string]any); ok {
+		for column, value := range filter {
+			if value != nil {
+				filters[column] = value
+			}
+		}
+	}
+
+	// one extra row tells whether there is a next page
+	persons, err := h.personService.Get(p.Context, filters, id, createdAt, first+1, order)
+	if err != nil {
+		return nil, h.newGraphQLErr(p.Context, "failed while getting persons", err)
+	}
+
+	conn := personConnection{
+		Edges: make([]personEdge, 0, len(persons)),
+	}
+
+	if len(persons) > first {
+		conn.PageInfo.HasNextPage = true
+		persons = persons[:first]
+	}
+
+	for i := range persons {
+		conn.Edges = append(conn.Edges, personEdge{
+			Cursor: encodeCursor(&persons[i]),
+			Node:   persons[i],
+		})
+	}
+
+	if len(conn.Edges) != 0 {
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
+
+	return conn, nil
+}
+
+func (h *Handler) resolvePerson(p graphql.ResolveParams) (any, error) {
+	if err := h.checkScope(p.Context, auth.ScopePersonsRead); err != nil {
+		return nil, err
+	}
+
+	id, _ := p.Args["id"].(string)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+
+	person, err := h.personService.GetByID(p.Context, id)
+	if err != nil {
+		return nil, h.newGraphQLErr(p.Context, "failed while getting person", err)
+	}
+
+	return person, nil
+}
+
+func (h *Handler) resolveCreatePerson(p graphql.ResolveParams) (any, error) {
+	if err := h.checkScope(p.Context, auth.ScopePersonsWrite); err != nil {
+		return nil, err
+	}
+
+	req := createPersonReq{}
+	req.Name, _ = p.Args["name"].(string)
+	req.Surname, _ = p.Args["surname"].(string)
+	req.Patronymic, _ = p.Args["patronymic"].(string)
+
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	person := &models.Person{
+		Name:       req.Name,
+		Surname:    req.Surname,
+		Patronymic: req.Patronymic,
+	}
+
+	// person is replaced with existing one if duplicate policy returns it
+	if _, _, err := h.personService.Create(p.Context, person); err != nil {
+		return nil, h.newGraphQLErr(p.Context, "failed while creating person", err)
+	}
+
+	return person, nil
+}
+
+func (h *Handler) resolveUpdatePerson(p graphql.ResolveParams) (any, error) {
+	if err := h.checkScope(p.Context, auth.ScopePersonsWrite); err != nil {
+		return nil, err
+	}
+
+	id, _ := p.Args["id"].(string)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+
+	input, _ := p.Args["input"].(map[string]any)
+
+	var req updatePersonRequest
+	for field, value := range input {
+		switch field {
+		case "name":
+			req.Name = stringPtr(value)
+		case "surname":
+			req.Surname = stringPtr(value)
+		case "patronymic":
+			req.Patronymic = stringPtr(value)
+		case "gender":
+			req.Gender = stringPtr(value)
+		case "nationality":
+			req.Nationality = stringPtr(value)
+		case "age":
+			if age, ok := value.(int); ok {
+				if age < 0 || age > 120 {
+					return nil, errors.New("invalid age, it must be greater than 0 and less than 120")
+				}
+				a := int8(age)
+				req.Age = &a
+			}
+		}
+	}
+
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	fields := req.toMap()
+	if len(fields) == 0 {
+		return nil, errNothingToUpdate
+	}
+
+	person, err := h.personService.Update(p.Context, id, fields)
+	if err != nil {
+		return nil, h.newGraphQLErr(p.Context, "failed while updating person", err)
+	}
+
+	return person, nil
+}
+
+func (h *Handler) resolveDeletePerson(p graphql.ResolveParams) (any, error) {
+	if err := h.checkScope(p.Context, auth.ScopePersonsDelete); err != nil {
+		return nil, err
+	}
+
+	id, _ := p.Args["id"].(string)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+
+	if _, err := h.personService.Delete(p.Context, id); err != nil {
+		return nil, h.newGraphQLErr(p.Context, "failed while deleting person", err)
+	}
+
+	return id, nil
+}
+
+// checkScope is graphql counterpart of requireScope middleware.
+func (h *Handler) checkScope(ctx context.Context, scope auth.Scope) error {
+	if !h.authEnabled {
+		return nil
+	}
+
+	principal := auth.PrincipalFrom(ctx)
+	if principal == nil {
+		return errUnauthenticated
+	}
+
+	if !principal.HasScope(scope) {
+		return fmt.Errorf("%w: %s", errMissingScope, scope)
+	}
+
+	return nil
+}
+
+// newGraphQLErr logs err and hides its details from client unless it is a custom one.
+func (h *Handler) newGraphQLErr(ctx context.Context, msg string, err error) error {
+	h.log.ErrorContext(ctx, msg, "error", err.Error())
+
+	if !errIsCustom(err) {
+		return fmt.Errorf("%s: unexpected error", msg)
+	}
+
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+func encodeCursor(person *models.Person) string {
+	return base64.URLEncoding.EncodeToString(
+		[]byte(person.CreatedAt.Format(cursorLayout) + cursorSeparator + person.ID))
+}
+
+func decodeCursor(cursor string) (id, createdAt string, err error) {
+	raw, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", errInvalidCursor
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), cursorSeparator)
+	if !found {
+		return "", "", errInvalidCursor
+	}
+
+	if _, err = time.Parse(cursorLayout, createdAt); err != nil {
+		return "", "", errInvalidCursor
+	}
+
+	if _, err = uuid.Parse(id); err != nil {
+		return "", "", errInvalidCursor
+	}
+
+	return id, createdAt, nil
+}
+
+func stringPtr(v any) *string {
+	s, ok := v.(string)
+	if !ok {
+		return nil
+	}
+
+	return &s
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+const (
+	maxQueryDepth      = 8
+	maxQueryComplexity = 1000
+)
+
+var (
+	errFragmentCycle = errors.New("fragment cycle detected")
+)
+
+// complexityCounter estimates the cost of the query before it is executed:
+// every field costs 1 and the selection of the persons connection is multiplied by requested `first`.
+type complexityCounter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+	visiting  map[string]bool
+}
+
+func checkQueryComplexity(query, operationName string, variables map[string]any) error {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		// syntax errors are reported by graphql executor itself
+		return nil
+	}
+
+	c := &complexityCounter{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		visiting:  make(map[string]bool),
+	}
+
+	var operations []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			c.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operations = append(operations, def)
+			}
+		}
+	}
+
+	for _, op := range operations {
+		cost, depth, err := c.selectionSet(op.SelectionSet)
+		if err != nil {
+			return err
+		}
+
+		if depth > maxQueryDepth {
+			return fmt.Errorf("query depth %d exceeds max depth %d", depth, maxQueryDepth)
+		}
+
+		if cost > maxQueryComplexity {
+			return fmt.Errorf("query complexity %d exceeds max complexity %d", cost, maxQueryComplexity)
+		}
+	}
+
+	return nil
+}
+
+func (c *complexityCounter) selectionSet(set *ast.SelectionSet) (cost, depth int, err error) {
+	if set == nil {
+		return 0, 0, nil
+	}
+
+	for _, selection := range set.Selections {
+		var selCost, selDepth int
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			selCost, selDepth, err = c.field(selection)
+		case *ast.InlineFragment:
+			selCost, selDepth, err = c.selectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			selCost, selDepth, err = c.fragmentSpread(selection)
+		}
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		cost += selCost
+		depth = max(depth, selDepth)
+	}
+
+	return cost, depth, nil
+}
+
+func (c *complexityCounter) field(field *ast.Field) (cost, depth int, err error) {
+	childCost, childDepth, err := c.selectionSet(field.SelectionSet)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	multiplier := 1
+	if field.Name.Value == "persons" {
+		// out of range first would also fail in resolver, but negative one could offset costs of
+		// other fields executed in the same query
+		multiplier, err = c.intArgument(field, "first", defaultPersonsFirst)
+		if err != nil {
+			return 0, 0, err
+		}
+		if multiplier <= 0 || multiplier > maxPersonsFirst {
+			return 0, 0, fmt.Errorf("first must be between 1 and %d", maxPersonsFirst)
+		}
+	}
+
+	return 1 + childCost*multiplier, 1 + childDepth, nil
+}
+
+func (c *complexityCounter) fragmentSpread(spread *ast.FragmentSpread) (cost, depth int, err error) {
+	name := spread.Name.Value
+
+	fragment, ok := c.fragments[name]
+	if !ok {
+		// unknown fragments are reported by graphql validator
+		return 0, 0, nil
+	}
+
+	if c.visiting[name] {
+		return 0, 0, errFragmentCycle
+	}
+
+	c.visiting[name] = true
+	defer delete(c.visiting, name)
+
+	return c.selectionSet(fragment.SelectionSet)
+}
+
+// intArgument returns value of int argument, or defaultValue if argument or its variable isn't set.
+func (c *complexityCounter) intArgument(field *ast.Field, name string, defaultValue int) (int, error) {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != name {
+			continue
+		}
+
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			n, err := strconv.Atoi(value.Value)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			return n, nil
+		case *ast.Variable:
+			switch n := c.variables[value.Name.Value].(type) {
+			case nil:
+				return defaultValue, nil
+			case float64:
+				return int(n), nil
+			case int:
+				return n, nil
+			default:
+				return 0, fmt.Errorf("invalid %s: variable %s isn't int", name, value.Name.Value)
+			}
+		default:
+			return 0, fmt.Errorf("invalid %s: int is expected", name)
+		}
+	}
+
+	return defaultValue, nil
+}
@@ -0,0 +1,150 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/handlers"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/ratelimit"
+)
+
+// countingPersonService counts queries of persons which reach the service.
+type countingPersonService struct {
+	handlers.PersonService
+
+	gets atomic.Int32
+}
+
+func (s *countingPersonService) Get(context.Context, map[string]any, string, string, int, models.Order) ([]models.Person, error) {
+	s.gets.Add(1)
+	return nil, nil
+}
+
+func postGraphQL(t *testing.T, query string, variables map[string]any) (int, *countingPersonService) {
+	t.Helper()
+
+	personService := &countingPersonService{}
+	h := handlers.NewHandler(config.HandlerConfig{MaxBodyBytes: 1 << 20}, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		personService, nil, nil, nil, nil, nil, nil)
+
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		t.Fatalf("failed to encode request: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.InitRoutes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body)))
+
+	return w.Code, personService
+}
+
+// aliasedPersons builds query with n aliases of persons(first: 100) and one alias with given first.
+func aliasedPersons(n int, first string) string {
+	var b strings.Builder
+	b.WriteString("query($first: Int) {")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, " a%d: persons(first: 100) { edges { node { id name } } }", i)
+	}
+	fmt.Fprintf(&b, " neg: persons(first: %s) { edges { node { id name } } } }", first)
+	return b.String()
+}
+
+func TestGraphQLComplexityCantBeOffsetByNegativeFirst(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     string
+		variables map[string]any
+	}{
+		{name: "literal", first: "-1000000"},
+		{name: "variable", first: "$first", variables: map[string]any{"first": -1000000}},
+		{name: "above max", first: "1000000"},
+	}
+
+	for _, tt := range tests {
+		code, personService := postGraphQL(t, aliasedPersons(20, tt.first), tt.variables)
+
+		if code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", tt.name, http.StatusBadRequest, code)
+		}
+		if gets := personService.gets.Load(); gets != 0 {
+			t.Errorf("%s: query was executed, persons were fetched %d times", tt.name, gets)
+		}
+	}
+}
+
+func TestGraphQLQueryWithinComplexityIsExecuted(t *testing.T) {
+	code, personService := postGraphQL(t, `{ a: persons(first: 100) { edges { node { id } } } b: persons { edges { node { id } } } }`, nil)
+
+	if code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if gets := personService.gets.Load(); gets != 2 {
+		t.Fatalf("expected persons to be fetched twice, got %d", gets)
+	}
+}
+
+// recordingLimiter allows every request and remembers whether it was charged as write.
+type recordingLimiter struct {
+	mu     sync.Mutex
+	writes []bool
+}
+
+func (l *recordingLimiter) Allow(_ context.Context, _ string, write bool) (ratelimit.Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.writes = append(l.writes, write)
+	return ratelimit.Result{Allowed: true, Limit: 10, Remaining: 10}, nil
+}
+
+func TestGraphQLQueriesAreLimitedAsReads(t *testing.T) {
+	limiter := &recordingLimiter{}
+	personService := &countingPersonService{}
+	h := handlers.NewHandler(config.HandlerConfig{MaxBodyBytes: 1 << 20, RateLimitEnabled: true},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), personService, nil, nil, limiter, nil, nil, nil)
+	routes := h.InitRoutes()
+
+	const both = `query list { persons { edges { node { id } } } } mutation remove { deletePerson(id: "person-id") }`
+
+	tests := []struct {
+		name  string
+		body  string
+		write bool
+	}{
+		{name: "query", body: `{"query": "{ persons { edges { node { id } } } }"}`},
+		{name: "mutation", body: `{"query": "mutation { deletePerson(id: \"person-id\") }"}`, write: true},
+		{name: "named query", body: fmt.Sprintf(`{"query": %q, "operationName": "list"}`, both)},
+		{name: "named mutation", body: fmt.Sprintf(`{"query": %q, "operationName": "remove"}`, both), write: true},
+		{name: "unnamed of several", body: fmt.Sprintf(`{"query": %q}`, both), write: true},
+		{name: "invalid query", body: `{"query": "{ persons"}`, write: true},
+	}
+
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(tt.body)))
+
+		if len(limiter.writes) != i+1 {
+			t.Fatalf("%s: request isn't rate limited", tt.name)
+		}
+		if write := limiter.writes[i]; write != tt.write {
+			t.Errorf("%s: expected write %t, got %t", tt.name, tt.write, write)
+		}
+	}
+
+	// body read by limiter still reaches graphql handler
+	if gets := personService.gets.Load(); gets != 2 {
+		t.Fatalf("expected persons to be fetched by both queries, got %d", gets)
+	}
+}
@@ -2,68 +2,230 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/handlers/openapi"
+	"github.com/HeadGardener/effective_mobile/internal/metrics"
 	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/ratelimit"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/graphql-go/graphql"
 )
 
 const (
 	minute = time.Minute
 )
 
+// personBodyLimit and apiKeyBodyLimit are limits of bodies holding a single small object, other
+// routes are limited by MaxBodyBytes.
+const (
+	personBodyLimit = 64 << 10
+	apiKeyBodyLimit = 16 << 10
+)
+
 const (
 	personIDParam    = "person_id"
+	apiKeyIDParam    = "key_id"
 	personIDQuery    = "person_id"
 	createdAtQuery   = "created_at"
 	limitQuery       = "limit"
 	nameQuery        = "name"
 	surnameQuery     = "surname"
+	patronymicQuery  = "patronymic"
 	ageQuery         = "age"
 	genderQuery      = "gender"
 	nationalityQuery = "nationality"
+	similarityQuery  = "similarity"
+)
+
+const (
+	defaultDuplicatePairs = 100
+	maxDuplicatePairs     = 1000
+	maxMergeSources       = 100
 )
 
 type PersonService interface {
-	Create(ctx context.Context, person *models.Person) (string, error)
-	Get(ctx context.Context, filters map[string]any, id, createdAt string, limit int) ([]models.Person, error)
-	Delete(ctx context.Context, id string) error
-	Update(ctx context.Context, id string, fields map[string]any) error
+	Create(ctx context.Context, person *models.Person) (string, bool, error)
+	Get(ctx context.Context, filters map[string]any, id, createdAt string, limit int, order models.Order) ([]models.Person, error)
+	GetByID(ctx context.Context, id string) (*models.Person, error)
+	Delete(ctx context.Context, id string) (*models.Person, error)
+	Update(ctx context.Context, id string, fields map[string]any) (*models.Person, error)
+	Duplicates(ctx context.Context, similarity float64, limit int) ([]models.DuplicateCluster, error)
+	Merge(ctx context.Context, targetID string, sourceIDs []string) (*models.Person, error)
+}
+
+type APIKeyService interface {
+	Create(ctx context.Context, name, tenantID string, scopes []auth.Scope) (string, *models.APIKey, error)
+	List(ctx context.Context) ([]models.APIKey, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+// Authenticator returns principal owning bearer token, either api key or JWT.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*auth.Principal, error)
+}
+
+// RateLimiter takes a token from read or write bucket of client identified by key.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, write bool) (ratelimit.Result, error)
+}
+
+// QuotaReporter returns request quotas of enrichment apis.
+type QuotaReporter interface {
+	Quotas() []models.UpstreamQuota
+}
+
+// IdempotencyStore keeps responses to requests with Idempotency-Key. Reserve returns nil if key is
+// reserved by the caller, and the record of another request otherwise.
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key models.IdempotencyKey, fingerprint string, ttl time.Duration) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, key models.IdempotencyKey, fingerprint string, status int, headers http.Header, response []byte) error
+	Release(ctx context.Context, key models.IdempotencyKey, fingerprint string) error
+}
+
+type HealthService interface {
+	Ready(ctx context.Context) error
+	Details(ctx context.Context) models.HealthDetails
 }
 
 type Handler struct {
 	log *slog.Logger
 
-	personService PersonService
+	// validateRequests and rateLimitEnabled can be switched by Reload while serving
+	validateRequests atomic.Bool
+	rateLimitEnabled atomic.Bool
+	authEnabled      bool
+	maxBodyBytes     int64
+	idempotencyTTL   time.Duration
+	// inFlight holds a token per request being served, it is nil if concurrency isn't limited
+	inFlight chan struct{}
+	spec     *openapi.Spec
+
+	personService    PersonService
+	apiKeyService    APIKeyService
+	authenticator    Authenticator
+	rateLimiter      RateLimiter
+	quotaReporter    QuotaReporter
+	healthService    HealthService
+	idempotencyStore IdempotencyStore
+	gqlSchema        graphql.Schema
 }
 
-func NewHandler(personService PersonService) *Handler {
-	return &Handler{
-		log:           slog.New(slog.NewJSONHandler(os.Stdout, nil)),
-		personService: personService,
+func NewHandler(conf config.HandlerConfig, log *slog.Logger, personService PersonService,
+	apiKeyService APIKeyService, authenticator Authenticator, rateLimiter RateLimiter,
+	quotaReporter QuotaReporter, healthService HealthService, idempotencyStore IdempotencyStore) *Handler {
+	h := &Handler{
+		log:              log,
+		authEnabled:      conf.AuthEnabled,
+		maxBodyBytes:     int64(conf.MaxBodyBytes),
+		idempotencyTTL:   conf.IdempotencyTTL,
+		personService:    personService,
+		apiKeyService:    apiKeyService,
+		authenticator:    authenticator,
+		rateLimiter:      rateLimiter,
+		quotaReporter:    quotaReporter,
+		healthService:    healthService,
+		idempotencyStore: idempotencyStore,
+	}
+	if conf.MaxConcurrentRequests > 0 {
+		h.inFlight = make(chan struct{}, conf.MaxConcurrentRequests)
 	}
+	h.Reload(conf)
+
+	spec, err := openapi.Load()
+	if err != nil {
+		// spec is embedded into the binary, so it can only be broken by a programming error
+		panic(err.Error())
+	}
+	h.spec = spec
+
+	schema, err := newGraphQLSchema(h)
+	if err != nil {
+		// schema is static, so it can only be broken by a programming error
+		panic(fmt.Sprintf("invalid graphql schema: %s", err.Error()))
+	}
+	h.gqlSchema = schema
+
+	return h
+}
+
+// Reload switches request validation and rate limiting, authentication can't be switched
+// without restart.
+func (h *Handler) Reload(conf config.HandlerConfig) {
+	h.validateRequests.Store(conf.ValidateRequests)
+	h.rateLimitEnabled.Store(conf.RateLimitEnabled)
 }
 
 func (h *Handler) InitRoutes() http.Handler {
 	r := chi.NewRouter()
 
+	r.Use(h.measure)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(h.logRequest)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(minute))
+	r.Use(h.limitBody(h.maxBodyBytes))
 
-	r.Route("/api", func(r chi.Router) {
-		r.Use(h.logRequest)
-		r.Post("/", h.createPerson)
-		r.Get("/", h.getPersons)
-		r.Put("/{person_id}", h.updatePerson)
-		r.Delete("/{person_id}", h.deletePerson)
+	r.Use(h.validateRequest)
+
+	r.Group(func(r chi.Router) {
+		// probes, metrics and docs are never shed, so overloaded instance isn't restarted
+		r.Use(h.shed)
+
+		if h.authEnabled {
+			r.Use(h.authenticate)
+		}
+
+		// limits are applied after authentication, as clients are identified by principal
+		r.Use(h.rateLimit)
+
+		r.Route("/api", func(r chi.Router) {
+			r.With(h.requireScope(auth.ScopePersonsWrite), h.limitBody(personBodyLimit), h.idempotent).
+				Post("/", h.createPerson)
+			r.With(h.requireScope(auth.ScopePersonsRead)).Get("/", h.getPersons)
+			r.With(h.requireScope(auth.ScopePersonsRead)).Get("/duplicates", h.getDuplicates)
+			// merge deletes sources, so it needs both scopes
+			r.With(h.requireScope(auth.ScopePersonsWrite), h.requireScope(auth.ScopePersonsDelete),
+				h.limitBody(personBodyLimit)).Post("/merge", h.mergePersons)
+			r.With(h.requireScope(auth.ScopePersonsRead)).Get("/{person_id}", h.getPerson)
+			r.With(h.requireScope(auth.ScopePersonsWrite), h.limitBody(personBodyLimit)).Put("/{person_id}", h.updatePerson)
+			r.With(h.requireScope(auth.ScopePersonsDelete)).Delete("/{person_id}", h.deletePerson)
+		})
+
+		// scopes of graphql operations are checked by resolvers
+		r.Post(graphQLPath, h.graphQL)
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(h.requireScope(auth.ScopeAdmin))
+			r.With(h.limitBody(apiKeyBodyLimit)).Post("/api-keys", h.createAPIKey)
+			r.Get("/api-keys", h.listAPIKeys)
+			r.Delete("/api-keys/{key_id}", h.revokeAPIKey)
+			r.Get("/quotas", h.getQuotas)
+		})
+	})
+
+	// details aren't shed, but reveal db and enrichment apis state, so they are for admins only
+	r.Group(func(r chi.Router) {
+		if h.authEnabled {
+			r.Use(h.authenticate)
+		}
+		r.Use(h.rateLimit)
+		r.With(h.requireScope(auth.ScopeAdmin)).Get("/health/details", h.getHealthDetails)
 	})
 
+	r.Get("/healthz", h.healthz)
+	r.Get("/readyz", h.readyz)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+	r.Get("/openapi.json", h.getOpenAPISpec)
+	r.Get("/docs", h.getDocs)
+
 	return r
 }
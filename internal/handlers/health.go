@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+)
+
+type dbHealthResp struct {
+	Reachable         bool    `json:"reachable"`
+	LatencyMS         float64 `json:"latency_ms"`
+	PendingMigrations int     `json:"pending_migrations"`
+	Error             string  `json:"error,omitempty"`
+}
+
+type upstreamHealthResp struct {
+	Upstream  string  `json:"upstream"`
+	Reachable bool    `json:"reachable"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type healthDetailsResp struct {
+	Status    string               `json:"status"`
+	Draining  bool                 `json:"draining"`
+	DB        dbHealthResp         `json:"db"`
+	Upstreams []upstreamHealthResp `json:"upstreams"`
+}
+
+// healthz only tells that process is alive and serves requests.
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	h.newResponse(w, r, http.StatusOK, map[string]any{
+		"status": "ok",
+	})
+}
+
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	if err := h.healthService.Ready(r.Context()); err != nil {
+		h.log.WarnContext(r.Context(), "service is not ready", "error", err.Error())
+		h.newResponse(w, r, http.StatusServiceUnavailable, map[string]any{
+			"status": "not ready",
+			"reason": err.Error(),
+		})
+		return
+	}
+
+	h.newResponse(w, r, http.StatusOK, map[string]any{
+		"status": "ready",
+	})
+}
+
+// getHealthDetails responds with 503 only if service isn't ready, unreachable enrichment apis
+// make it degraded.
+func (h *Handler) getHealthDetails(w http.ResponseWriter, r *http.Request) {
+	details := h.healthService.Details(r.Context())
+
+	resp := healthDetailsResp{
+		Status:   "ok",
+		Draining: details.Draining,
+		DB: dbHealthResp{
+			Reachable:         details.DB.Reachable,
+			LatencyMS:         toMilliseconds(details.DB.Latency),
+			PendingMigrations: details.DB.PendingMigrations,
+			Error:             details.DB.Error,
+		},
+		Upstreams: make([]upstreamHealthResp, 0, len(details.Upstreams)),
+	}
+
+	for _, u := range details.Upstreams {
+		resp.Upstreams = append(resp.Upstreams, upstreamHealthResp{
+			Upstream:  u.Upstream,
+			Reachable: u.Reachable,
+			LatencyMS: toMilliseconds(u.Latency),
+			Error:     u.Error,
+		})
+
+		if !u.Reachable {
+			resp.Status = "degraded"
+		}
+	}
+
+	code := http.StatusOK
+	if !details.Ready {
+		resp.Status = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+
+	h.newResponse(w, r, code, resp)
+}
+
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -1,12 +1,400 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/logger"
+	"github.com/HeadGardener/effective_mobile/internal/metrics"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+	"github.com/HeadGardener/effective_mobile/internal/tracing"
+)
+
+const (
+	authorizationHeader = "Authorization"
+	bearerPrefix        = "Bearer "
+
+	rateLimitLimitHeader     = "X-RateLimit-Limit"
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+	retryAfterHeader         = "Retry-After"
+
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+
+	// unmatchedRoute labels requests not matching any route, so that scanners can't blow up metrics cardinality.
+	unmatchedRoute = "unmatched"
+)
+
+// replayedHeaders are saved with idempotent response, the rest, e.g. rate limit headers, describe
+// the request being served rather than the response.
+var replayedHeaders = []string{"Content-Type", "Content-Language", "Location"}
+
+var (
+	errInvalidAuthHeader = errors.New("authorization header must be in 'Bearer <token>' format")
+	errUnauthenticated   = errors.New("authentication required")
+	errMissingScope      = errors.New("missing scope")
+	errRateLimited       = errors.New("rate limit exceeded")
+	errBodyTooLarge      = errors.New("request body is too large")
+	errOverloaded        = errors.New("server is overloaded")
+
+	errInvalidIdempotencyKey    = fmt.Errorf("idempotency key must be at most %d characters long", maxIdempotencyKeyLength)
+	errIdempotencyKeyReused     = errors.New("idempotency key is already used for another request")
+	errIdempotencyKeyInProgress = errors.New("request with the same idempotency key is in progress")
 )
 
+var tracer = tracing.Tracer("internal/handlers")
+
+// measure traces request, continuing trace from traceparent header if there is one, and records its duration.
+// Both are named by route pattern, which is known only after routing.
+func (h *Handler) measure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethod(r.Method)))
+		defer span.End()
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		metrics.ObserveHTTPRequest(r.Method, route, status, start)
+	})
+}
+
+// logRequest puts request id set by RequestID middleware into context for logger and logs request.
+// Url is PII, as query holds names of persons.
 func (h *Handler) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		h.log.Info("got http request", "method", r.Method, "url", r.URL.String())
+		start := time.Now()
+		ctx := logger.WithRequestID(r.Context(), middleware.GetReqID(r.Context()))
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		h.log.InfoContext(ctx, "got http request", "method", r.Method, logger.PII("url", r.URL.String()),
+			"remote_addr", r.RemoteAddr)
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		h.log.InfoContext(ctx, "handled http request", "status", ww.Status(), "bytes", ww.BytesWritten(),
+			"duration", time.Since(start).String())
+	})
+}
+
+func (h *Handler) validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.validateRequests.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := h.spec.ValidateRequest(r); err != nil {
+			h.newErrResponse(w, r, statusFromBodyErr(err), "invalid request", err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitBody rejects requests declaring body larger than limit, and makes reading of longer bodies
+// fail. Limits nest, so a route can lower the limit set for every route.
+func (h *Handler) limitBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				h.newErrResponse(w, r, http.StatusRequestEntityTooLarge, "failed while reading request", errBodyTooLarge)
+				return
+			}
+
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// shed rejects requests above MaxConcurrentRequests instead of queueing them, so that overloaded
+// instance answers at once and clients can retry on other replicas.
+func (h *Handler) shed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.inFlight == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case h.inFlight <- struct{}{}:
+			defer func() { <-h.inFlight }()
+			next.ServeHTTP(w, r)
+		default:
+			metrics.IncHTTPRequestShed()
+			w.Header().Set(retryAfterHeader, "1")
+			h.newErrResponse(w, r, http.StatusServiceUnavailable, "too many concurrent requests", errOverloaded)
+		}
+	})
+}
+
+// authenticate puts principal owning bearer api key or JWT and its tenant into request context.
+// Without Authorization header principal is taken from client certificate verified by mutual TLS,
+// requests without both stay anonymous and are rejected by requireScope.
+func (h *Handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			principal *auth.Principal
+			err       error
+		)
+
+		header := r.Header.Get(authorizationHeader)
+		switch {
+		case header != "":
+			token, found := strings.CutPrefix(header, bearerPrefix)
+			if !found || token == "" {
+				h.newErrResponse(w, r, http.StatusUnauthorized, "failed while authenticating request",
+					errInvalidAuthHeader)
+				return
+			}
+
+			principal, err = h.authenticator.Authenticate(r.Context(), token)
+		case r.TLS != nil && len(r.TLS.VerifiedChains) != 0:
+			principal, err = auth.PrincipalFromCertificate(r.TLS.VerifiedChains[0][0])
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err != nil {
+			h.newErrResponse(w, r, statusFromAuthErr(err), "failed while authenticating request", err)
+			return
+		}
+
+		ctx := auth.WithPrincipal(r.Context(), principal)
+		next.ServeHTTP(w, r.WithContext(tenant.WithID(ctx, principal.TenantID)))
+	})
+}
+
+func (h *Handler) requireScope(scope auth.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !h.authEnabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal := auth.PrincipalFrom(r.Context())
+			if principal == nil {
+				h.newErrResponse(w, r, http.StatusUnauthorized, "unauthorized", errUnauthenticated)
+				return
+			}
+
+			if !principal.HasScope(scope) {
+				h.newErrResponse(w, r, http.StatusForbidden, "forbidden",
+					fmt.Errorf("%w: %s", errMissingScope, scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimit limits requests of principal, or of client ip for anonymous requests. Reads and writes are
+// limited separately, graphql queries count as reads and mutations as writes. If limiter fails, request
+// is let through, as limits aren't worth an outage.
+func (h *Handler) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.rateLimitEnabled.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// RemoteAddr is replaced with ip from X-Forwarded-For or X-Real-IP by RealIP middleware,
+		// otherwise it contains port
+		ip := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			ip = host
+		}
+
+		key := "ip:" + ip
+		if principal := auth.PrincipalFrom(r.Context()); principal != nil {
+			key = "principal:" + principal.ID
+		}
+
+		write := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+		// graphql queries are posted too, so they are told from mutations by the body
+		if write && r.URL.Path == graphQLPath {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				h.newErrResponse(w, r, statusFromBodyErr(err), "failed while reading request", err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			write = isGraphQLMutation(body)
+		}
+
+		res, err := h.rateLimiter.Allow(r.Context(), key, write)
+		if err != nil {
+			h.log.ErrorContext(r.Context(), "failed while checking rate limit", "error", err.Error())
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(rateLimitLimitHeader, strconv.Itoa(res.Limit))
+		w.Header().Set(rateLimitRemainingHeader, strconv.Itoa(res.Remaining))
+		w.Header().Set(rateLimitResetHeader, strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			w.Header().Set(retryAfterHeader, strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+			h.newErrResponse(w, r, http.StatusTooManyRequests, "too many requests", errRateLimited)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
+
+// idempotent replays response to the first request with the same Idempotency-Key of principal, and
+// rejects key reused for another request. Keys of requests failed with 5xx are released, so that
+// they can be retried.
+func (h *Handler) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(idempotencyKeyHeader)
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(header) > maxIdempotencyKeyLength {
+			h.newErrResponse(w, r, http.StatusBadRequest, "invalid idempotency key", errInvalidIdempotencyKey)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.newErrResponse(w, r, statusFromBodyErr(err), "failed while reading request", err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := models.IdempotencyKey{
+			TenantID: tenant.FromContext(r.Context()),
+			Key:      header,
+		}
+		if principal := auth.PrincipalFrom(r.Context()); principal != nil {
+			key.PrincipalID = principal.ID
+		}
+
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		rec, err := h.idempotencyStore.Reserve(r.Context(), key, fingerprint, h.idempotencyTTL)
+		if err != nil {
+			h.newErrResponse(w, r, http.StatusInternalServerError, "failed while reserving idempotency key", err)
+			return
+		}
+
+		switch {
+		case rec == nil:
+		case rec.Fingerprint != fingerprint:
+			h.newErrResponse(w, r, http.StatusUnprocessableEntity, "idempotency key reused", errIdempotencyKeyReused)
+			return
+		case rec.StatusCode == 0:
+			w.Header().Set(retryAfterHeader, "1")
+			h.newErrResponse(w, r, http.StatusConflict, "idempotency key in progress", errIdempotencyKeyInProgress)
+			return
+		default:
+			h.log.InfoContext(r.Context(), "replaying response", "status", rec.StatusCode)
+			for name, values := range rec.Headers {
+				w.Header()[name] = values
+			}
+			w.Header().Set(idempotentReplayedHeader, "true")
+			w.WriteHeader(rec.StatusCode)
+			_, _ = w.Write(rec.Response)
+			return
+		}
+
+		// key is saved even if request is canceled, as person may be already created
+		ctx := context.WithoutCancel(r.Context())
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			// request failed or panicked
+			if releaseErr := h.idempotencyStore.Release(ctx, key, fingerprint); releaseErr != nil {
+				h.log.ErrorContext(ctx, "failed to release idempotency key", "error", releaseErr.Error())
+			}
+		}()
+
+		var buf bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&buf)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= http.StatusInternalServerError {
+			return
+		}
+
+		headers := make(http.Header)
+		for _, name := range replayedHeaders {
+			if values := ww.Header().Values(name); len(values) != 0 {
+				headers[name] = values
+			}
+		}
+
+		completed = true
+		if err = h.idempotencyStore.Complete(ctx, key, fingerprint, status, headers, buf.Bytes()); err != nil {
+			h.log.ErrorContext(ctx, "failed to save idempotent response", "error", err.Error())
+		}
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8"/>
+  <title>effective_mobile api</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css"/>
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+<script>
+  window.onload = () => {
+    window.ui = SwaggerUIBundle({url: '/openapi.json', dom_id: '#swagger-ui'});
+  };
+</script>
+</body>
+</html>`
+
+func (h *Handler) getOpenAPISpec(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(h.spec.JSON())
+}
+
+func (h *Handler) getDocs(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(swaggerUIPage))
+}
+
+// CheckOpenAPI reports disagreement between routes registered in router and openapi spec.
+func (h *Handler) CheckOpenAPI(router http.Handler) error {
+	routes, ok := router.(chi.Routes)
+	if !ok {
+		return errors.New("router doesn't expose its routes")
+	}
+
+	return h.spec.CheckRoutes(routes)
+}
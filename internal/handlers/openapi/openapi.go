@@ -0,0 +1,193 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed openapi.json
+var specJSON []byte
+
+type Spec struct {
+	raw []byte
+
+	paths   map[string]*pathItem
+	schemas map[string]*Schema
+}
+
+type document struct {
+	Paths      map[string]*pathItem `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type pathItem struct {
+	Parameters []Parameter `json:"parameters"`
+	Get        *Operation  `json:"get"`
+	Post       *Operation  `json:"post"`
+	Put        *Operation  `json:"put"`
+	Patch      *Operation  `json:"patch"`
+	Delete     *Operation  `json:"delete"`
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []Parameter  `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Load parses OpenAPI document embedded into the binary.
+func Load() (*Spec, error) {
+	var doc document
+	if err := json.Unmarshal(specJSON, &doc); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+
+	return &Spec{
+		raw:     specJSON,
+		paths:   doc.Paths,
+		schemas: doc.Components.Schemas,
+	}, nil
+}
+
+// JSON returns the document as it is served to clients.
+func (s *Spec) JSON() []byte {
+	return s.raw
+}
+
+func (p *pathItem) operations() map[string]*Operation {
+	ops := map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodPost:   p.Post,
+		http.MethodPut:    p.Put,
+		http.MethodPatch:  p.Patch,
+		http.MethodDelete: p.Delete,
+	}
+
+	for method, op := range ops {
+		if op == nil {
+			delete(ops, method)
+		}
+	}
+
+	return ops
+}
+
+// CheckRoutes reports every route registered in router but missing in the spec and vice versa.
+func (s *Spec) CheckRoutes(routes chi.Routes) error {
+	registered := make(map[string]bool)
+
+	if err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		registered[method+" "+route] = true
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range s.paths {
+		for method := range item.operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	var errs []string
+	for route := range registered {
+		if !documented[route] {
+			errs = append(errs, fmt.Sprintf("route %q is not described in openapi spec", route))
+		}
+	}
+
+	for route := range documented {
+		if !registered[route] {
+			errs = append(errs, fmt.Sprintf("openapi spec describes unregistered route %q", route))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.Strings(errs)
+
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// findOperation matches request path against path templates of the spec. Template with fewer params
+// wins, as router prefers static segments, e.g. /api/duplicates over /api/{person_id}.
+func (s *Spec) findOperation(method, path string) (*Operation, *pathItem, map[string]string) {
+	var (
+		found  *pathItem
+		params map[string]string
+	)
+
+	for template, item := range s.paths {
+		matched, ok := matchPath(template, path)
+		if !ok || (found != nil && len(matched) >= len(params)) {
+			continue
+		}
+
+		found, params = item, matched
+	}
+
+	if found == nil {
+		return nil, nil, nil
+	}
+
+	op, ok := found.operations()[method]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	return op, found, params
+}
+
+func matchPath(template, path string) (map[string]string, bool) {
+	tmplParts := strings.Split(template, "/")
+	pathParts := strings.Split(path, "/")
+
+	if len(tmplParts) != len(pathParts) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, part := range tmplParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			params[strings.Trim(part, "{}")] = pathParts[i]
+			continue
+		}
+
+		if part != pathParts[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
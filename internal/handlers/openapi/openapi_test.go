@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCheckRoutesReportsDisagreement(t *testing.T) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatalf("failed to load spec: %s", err)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/healthz", func(http.ResponseWriter, *http.Request) {})
+	r.Get("/undocumented", func(http.ResponseWriter, *http.Request) {})
+
+	err = spec.CheckRoutes(r)
+	if err == nil {
+		t.Fatal("expected disagreement to be reported")
+	}
+
+	for _, want := range []string{
+		`route "GET /undocumented" is not described in openapi spec`,
+		`openapi spec describes unregistered route "GET /readyz"`,
+		`openapi spec describes unregistered route "DELETE /api/{person_id}"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %q", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), `"GET /healthz"`) {
+		t.Errorf("documented and registered route is reported: %q", err)
+	}
+}
+
+func TestFindOperationPrefersStaticSegments(t *testing.T) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatalf("failed to load spec: %s", err)
+	}
+
+	tests := []struct {
+		path        string
+		operationID string
+		params      map[string]string
+	}{
+		{path: "/api/duplicates", operationID: "getDuplicates"},
+		{path: "/api/3f8d5a52-5c2a-4a4e-9d2b-1c6f0f4f5b7e", operationID: "getPerson",
+			params: map[string]string{"person_id": "3f8d5a52-5c2a-4a4e-9d2b-1c6f0f4f5b7e"}},
+	}
+
+	for _, tt := range tests {
+		op, _, params := spec.findOperation(http.MethodGet, tt.path)
+		if op == nil {
+			t.Errorf("%s: operation isn't found", tt.path)
+			continue
+		}
+		if op.OperationID != tt.operationID {
+			t.Errorf("%s: expected operation %s, got %s", tt.path, tt.operationID, op.OperationID)
+		}
+		for name, value := range tt.params {
+			if params[name] != value {
+				t.Errorf("%s: expected param %s=%s, got %q", tt.path, name, value, params[name])
+			}
+		}
+	}
+}
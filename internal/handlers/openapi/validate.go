@@ -0,0 +1,323 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	schemaRefPrefix = "#/components/schemas/"
+	jsonContentType = "application/json"
+)
+
+var (
+	ErrInvalidRequest = errors.New("request doesn't match api specification")
+)
+
+// Schema is a subset of JSON schema used by the spec.
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       schemaType         `json:"type"`
+	Format     string             `json:"format"`
+	Pattern    string             `json:"pattern"`
+	Enum       []any              `json:"enum"`
+	Minimum    *float64           `json:"minimum"`
+	Maximum    *float64           `json:"maximum"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	Required   []string           `json:"required"`
+	Properties map[string]*Schema `json:"properties"`
+	Items      *Schema            `json:"items"`
+}
+
+// schemaType holds "type" keyword, which can be either a string or a list of strings in OpenAPI 3.1.
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaType{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*t = multiple
+
+	return nil
+}
+
+func (t schemaType) allows(typ string) bool {
+	if len(t) == 0 {
+		return true
+	}
+
+	for _, allowed := range t {
+		if allowed == typ || (allowed == "number" && typ == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateRequest checks path, query params and json body of r against the spec.
+// Requests to paths or methods unknown to the spec are passed as is, router handles them.
+// Body of r is restored after validation.
+func (s *Spec) ValidateRequest(r *http.Request) error {
+	op, item, pathParams := s.findOperation(r.Method, r.URL.Path)
+	if op == nil {
+		return nil
+	}
+
+	params := append(append([]Parameter{}, item.Parameters...), op.Parameters...)
+	query := r.URL.Query()
+
+	for _, param := range params {
+		var (
+			value string
+			found bool
+		)
+
+		switch param.In {
+		case "path":
+			value, found = pathParams[param.Name]
+		case "query":
+			found = query.Has(param.Name)
+			value = query.Get(param.Name)
+		case "header":
+			value = r.Header.Get(param.Name)
+			found = value != ""
+		default:
+			continue
+		}
+
+		if !found {
+			if param.Required {
+				return fmt.Errorf("%w: %s param %q is required", ErrInvalidRequest, param.In, param.Name)
+			}
+			continue
+		}
+
+		if err := s.validateParam(param.Schema, value); err != nil {
+			return fmt.Errorf("%w: %s param %q: %s", ErrInvalidRequest, param.In, param.Name, err.Error())
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+
+	return s.validateBody(r, op.RequestBody)
+}
+
+func (s *Spec) validateBody(r *http.Request, body *RequestBody) error {
+	media, ok := body.Content[jsonContentType]
+	if !ok {
+		return nil
+	}
+
+	if r.Body == nil {
+		if body.Required {
+			return fmt.Errorf("%w: request body is required", ErrInvalidRequest)
+		}
+		return nil
+	}
+
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read body: %w", ErrInvalidRequest, err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+
+	if len(bytes.TrimSpace(raw)) == 0 {
+		if body.Required {
+			return fmt.Errorf("%w: request body is required", ErrInvalidRequest)
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var value any
+	if err = dec.Decode(&value); err != nil {
+		return fmt.Errorf("%w: body is not valid json: %s", ErrInvalidRequest, err.Error())
+	}
+
+	if err = s.validateValue(media.Schema, value, "body"); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRequest, err.Error())
+	}
+
+	return nil
+}
+
+func (s *Spec) validateParam(schema *Schema, value string) error {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	if schema.Type.allows("string") {
+		return s.validateValue(schema, value, "value")
+	}
+
+	// number allows integers too, so it is checked first
+	if schema.Type.allows("number") {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return errors.New("must be a number")
+		}
+		return s.validateValue(schema, json.Number(value), "value")
+	}
+
+	if schema.Type.allows("integer") {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return errors.New("must be an integer")
+		}
+		return s.validateValue(schema, json.Number(value), "value")
+	}
+
+	if schema.Type.allows("boolean") {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be a boolean")
+		}
+		return s.validateValue(schema, b, "value")
+	}
+
+	return nil
+}
+
+//nolint:gocyclo // flat switch over json schema keywords
+func (s *Spec) validateValue(schema *Schema, value any, path string) error {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	if len(schema.Enum) != 0 && !inEnum(schema.Enum, value) {
+		return fmt.Errorf("%s must be one of %v", path, schema.Enum)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		if !schema.Type.allows("null") {
+			return fmt.Errorf("%s can't be null", path)
+		}
+	case string:
+		if !schema.Type.allows("string") {
+			return fmt.Errorf("%s must be of type %s", path, strings.Join(schema.Type, " or "))
+		}
+		return validateString(schema, v, path)
+	case json.Number:
+		typ := "number"
+		if _, err := v.Int64(); err == nil {
+			typ = "integer"
+		}
+		if !schema.Type.allows(typ) {
+			return fmt.Errorf("%s must be of type %s", path, strings.Join(schema.Type, " or "))
+		}
+		return validateNumber(schema, v, path)
+	case bool:
+		if !schema.Type.allows("boolean") {
+			return fmt.Errorf("%s must be of type %s", path, strings.Join(schema.Type, " or "))
+		}
+	case []any:
+		if !schema.Type.allows("array") {
+			return fmt.Errorf("%s must be of type %s", path, strings.Join(schema.Type, " or "))
+		}
+		for i, item := range v {
+			if err := s.validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		if !schema.Type.allows("object") {
+			return fmt.Errorf("%s must be of type %s", path, strings.Join(schema.Type, " or "))
+		}
+		for _, field := range schema.Required {
+			if _, ok := v[field]; !ok {
+				return fmt.Errorf("%s.%s is required", path, field)
+			}
+		}
+		for field, item := range v {
+			if err := s.validateValue(schema.Properties[field], item, path+"."+field); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateString(schema *Schema, value, path string) error {
+	if schema.MinLength != nil && utf8.RuneCountInString(value) < *schema.MinLength {
+		return fmt.Errorf("%s must be at least %d characters long", path, *schema.MinLength)
+	}
+
+	if schema.MaxLength != nil && utf8.RuneCountInString(value) > *schema.MaxLength {
+		return fmt.Errorf("%s must be at most %d characters long", path, *schema.MaxLength)
+	}
+
+	if schema.Pattern != "" {
+		re, err := regexp.Compile(schema.Pattern)
+		if err == nil && !re.MatchString(value) {
+			return fmt.Errorf("%s must match pattern %s", path, schema.Pattern)
+		}
+	}
+
+	if schema.Format == "uuid" {
+		if _, err := uuid.Parse(value); err != nil {
+			return fmt.Errorf("%s must be a valid uuid", path)
+		}
+	}
+
+	return nil
+}
+
+func validateNumber(schema *Schema, value json.Number, path string) error {
+	n, err := value.Float64()
+	if err != nil {
+		return fmt.Errorf("%s must be a number", path)
+	}
+
+	if schema.Minimum != nil && n < *schema.Minimum {
+		return fmt.Errorf("%s must be greater than or equal to %v", path, *schema.Minimum)
+	}
+
+	if schema.Maximum != nil && n > *schema.Maximum {
+		return fmt.Errorf("%s must be less than or equal to %v", path, *schema.Maximum)
+	}
+
+	return nil
+}
+
+func (s *Spec) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.schemas[strings.TrimPrefix(schema.Ref, schemaRefPrefix)]
+	}
+
+	return schema
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,21 @@
+package handlers_test
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/handlers"
+)
+
+func TestRoutesAgreeWithOpenAPI(t *testing.T) {
+	for _, authEnabled := range []bool{true, false} {
+		conf := config.HandlerConfig{AuthEnabled: authEnabled, MaxBodyBytes: 1 << 20}
+		h := handlers.NewHandler(conf, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil, nil, nil, nil, nil)
+
+		if err := h.CheckOpenAPI(h.InitRoutes()); err != nil {
+			t.Errorf("auth enabled %t: %s", authEnabled, err)
+		}
+	}
+}
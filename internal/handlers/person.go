@@ -18,6 +18,8 @@ import (
 
 var (
 	letterRegexp = regexp.MustCompile(`[A-z]$`)
+
+	errNothingToUpdate = errors.New("nothing to update, at least one known field is required")
 )
 
 type createPersonReq struct {
@@ -26,6 +28,11 @@ type createPersonReq struct {
 	Patronymic string `json:"patronymic"`
 }
 
+type mergePersonsReq struct {
+	TargetID  string   `json:"target_id"`
+	SourceIDs []string `json:"source_ids"`
+}
+
 type updatePersonRequest struct {
 	Name        *string `json:"name"`
 	Surname     *string `json:"surname"`
@@ -39,12 +46,12 @@ func (h *Handler) createPerson(w http.ResponseWriter, r *http.Request) {
 	var req createPersonReq
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.newErrResponse(w, http.StatusBadRequest, "failed while decoding create person req", err)
+		h.newErrResponse(w, r, statusFromBodyErr(err), "failed while decoding create person req", err)
 		return
 	}
 
 	if err := req.validate(); err != nil {
-		h.newErrResponse(w, http.StatusBadRequest, "failed while validating create person req", err)
+		h.newErrResponse(w, r, http.StatusBadRequest, "failed while validating create person req", err)
 		return
 	}
 
@@ -54,13 +61,19 @@ func (h *Handler) createPerson(w http.ResponseWriter, r *http.Request) {
 		Patronymic: req.Patronymic,
 	}
 
-	id, err := h.personService.Create(r.Context(), person)
+	id, created, err := h.personService.Create(r.Context(), person)
 	if err != nil {
-		h.newErrResponse(w, http.StatusInternalServerError, "failed while creating person", err)
+		h.newErrResponse(w, r, statusFromErr(err), "failed while creating person", err)
 		return
 	}
 
-	h.newResponse(w, http.StatusCreated, map[string]any{
+	// existing person is returned by duplicate policy, service copies it into person
+	if !created {
+		h.newResponse(w, r, http.StatusOK, person)
+		return
+	}
+
+	h.newResponse(w, r, http.StatusCreated, map[string]any{
 		"id": id,
 	})
 }
@@ -70,69 +83,175 @@ func (h *Handler) getPersons(w http.ResponseWriter, r *http.Request) {
 	createdAt := r.URL.Query().Get(createdAtQuery)
 
 	if err := validatePersonIDAndCreatedAtQuery(id, createdAt); err != nil {
-		h.newErrResponse(w, http.StatusBadRequest, "failed while validation query", err)
+		h.newErrResponse(w, r, http.StatusBadRequest, "failed while validation query", err)
 		return
 	}
 
 	limit, err := strconv.Atoi(r.URL.Query().Get(limitQuery))
 	if err != nil {
-		h.newErrResponse(w, http.StatusBadRequest, "invalid limit value", err)
+		h.newErrResponse(w, r, http.StatusBadRequest, "invalid limit value", err)
 		return
 	}
 
 	filters, err := queryToMap(r.URL.Query())
 	if err != nil {
-		h.newErrResponse(w, http.StatusBadRequest, "invalid query params", err)
+		h.newErrResponse(w, r, http.StatusBadRequest, "invalid query params", err)
+		return
+	}
+
+	persons, err := h.personService.Get(r.Context(), filters, id, createdAt, limit, models.OrderDesc)
+	if err != nil {
+		h.newErrResponse(w, r, http.StatusInternalServerError, "failed while getting persons", err)
 		return
 	}
 
-	persons, err := h.personService.Get(r.Context(), filters, id, createdAt, limit)
+	h.newResponse(w, r, http.StatusOK, persons)
+}
+
+func (h *Handler) getPerson(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, personIDParam)
+
+	if _, err := uuid.Parse(id); err != nil {
+		h.newErrResponse(w, r, http.StatusBadRequest, "invalid person id", err)
+		return
+	}
+
+	person, err := h.personService.GetByID(r.Context(), id)
 	if err != nil {
-		h.newErrResponse(w, http.StatusInternalServerError, "failed while getting persons", err)
+		h.newErrResponse(w, r, statusFromErr(err), "failed while getting person", err)
 		return
 	}
 
-	h.newResponse(w, http.StatusOK, persons)
+	h.newResponse(w, r, http.StatusOK, person)
 }
 
 func (h *Handler) updatePerson(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, personIDParam)
 
+	if _, err := uuid.Parse(id); err != nil {
+		h.newErrResponse(w, r, http.StatusBadRequest, "invalid person id", err)
+		return
+	}
+
 	var req updatePersonRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.newErrResponse(w, http.StatusBadRequest, "failed while decoding update person req", err)
+		h.newErrResponse(w, r, statusFromBodyErr(err), "failed while decoding update person req", err)
 		return
 	}
 
 	if err := req.validate(); err != nil {
-		h.newErrResponse(w, http.StatusBadRequest, "failed while validating update person req", err)
+		h.newErrResponse(w, r, http.StatusBadRequest, "failed while validating update person req", err)
 		return
 	}
 
 	fields := req.toMap()
+	if len(fields) == 0 {
+		h.newErrResponse(w, r, http.StatusBadRequest, "failed while validating update person req", errNothingToUpdate)
+		return
+	}
 
-	if err := h.personService.Update(r.Context(), id, fields); err != nil {
-		h.newErrResponse(w, http.StatusInternalServerError, "failed while updating person", err)
+	person, err := h.personService.Update(r.Context(), id, fields)
+	if err != nil {
+		h.newErrResponse(w, r, statusFromErr(err), "failed while updating person", err)
 		return
 	}
 
-	h.newResponse(w, http.StatusOK, map[string]any{
-		"status": "updated",
-	})
+	h.newResponse(w, r, http.StatusOK, person)
 }
 
 func (h *Handler) deletePerson(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, personIDParam)
 
-	if err := h.personService.Delete(r.Context(), id); err != nil {
-		h.newErrResponse(w, http.StatusInternalServerError, "failed while deleting person", err)
+	if _, err := uuid.Parse(id); err != nil {
+		h.newErrResponse(w, r, http.StatusBadRequest, "invalid person id", err)
 		return
 	}
 
-	h.newResponse(w, http.StatusOK, map[string]any{
-		"status": "deleted",
-	})
+	person, err := h.personService.Delete(r.Context(), id)
+	if err != nil {
+		h.newErrResponse(w, r, statusFromErr(err), "failed while deleting person", err)
+		return
+	}
+
+	h.newResponse(w, r, http.StatusOK, person)
+}
+
+func (h *Handler) getDuplicates(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDuplicatePairs
+	if r.URL.Query().Has(limitQuery) {
+		var err error
+		if limit, err = strconv.Atoi(r.URL.Query().Get(limitQuery)); err != nil || limit < 1 || limit > maxDuplicatePairs {
+			h.newErrResponse(w, r, http.StatusBadRequest, "invalid limit value",
+				fmt.Errorf("limit must be between 1 and %d", maxDuplicatePairs))
+			return
+		}
+	}
+
+	var similarity float64
+	if r.URL.Query().Has(similarityQuery) {
+		var err error
+		if similarity, err = strconv.ParseFloat(r.URL.Query().Get(similarityQuery), 64); err != nil ||
+			similarity <= 0 || similarity > 1 {
+			h.newErrResponse(w, r, http.StatusBadRequest, "invalid similarity value",
+				errors.New("similarity must be greater than 0 and at most 1"))
+			return
+		}
+	}
+
+	clusters, err := h.personService.Duplicates(r.Context(), similarity, limit)
+	if err != nil {
+		h.newErrResponse(w, r, statusFromErr(err), "failed while getting duplicates", err)
+		return
+	}
+
+	h.newResponse(w, r, http.StatusOK, clusters)
+}
+
+func (h *Handler) mergePersons(w http.ResponseWriter, r *http.Request) {
+	var req mergePersonsReq
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.newErrResponse(w, r, statusFromBodyErr(err), "failed while decoding merge persons req", err)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		h.newErrResponse(w, r, http.StatusBadRequest, "failed while validating merge persons req", err)
+		return
+	}
+
+	person, err := h.personService.Merge(r.Context(), req.TargetID, req.SourceIDs)
+	if err != nil {
+		h.newErrResponse(w, r, statusFromErr(err), "failed while merging persons", err)
+		return
+	}
+
+	h.newResponse(w, r, http.StatusOK, person)
+}
+
+func (req *mergePersonsReq) validate() error {
+	if _, err := uuid.Parse(req.TargetID); err != nil {
+		return fmt.Errorf("invalid target_id: %w", err)
+	}
+
+	if len(req.SourceIDs) == 0 || len(req.SourceIDs) > maxMergeSources {
+		return fmt.Errorf("source_ids must contain from 1 to %d ids", maxMergeSources)
+	}
+
+	seen := map[string]bool{req.TargetID: true}
+	for _, id := range req.SourceIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("invalid source id: %w", err)
+		}
+
+		if seen[id] {
+			return fmt.Errorf("person %s is listed twice", id)
+		}
+		seen[id] = true
+	}
+
+	return nil
 }
 
 func (req *createPersonReq) validate() error {
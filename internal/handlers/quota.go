@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+)
+
+type quotaResp struct {
+	Upstream  string     `json:"upstream"`
+	Mode      string     `json:"mode"`
+	Limit     *int       `json:"limit"`
+	Remaining *int       `json:"remaining"`
+	ResetAt   *time.Time `json:"reset_at"`
+	Exhausted bool       `json:"exhausted"`
+}
+
+func (h *Handler) getQuotas(w http.ResponseWriter, r *http.Request) {
+	quotas := h.quotaReporter.Quotas()
+
+	resp := make([]quotaResp, 0, len(quotas))
+	for i := range quotas {
+		q := &quotas[i]
+		item := quotaResp{
+			Upstream:  q.Upstream,
+			Mode:      q.Mode,
+			Exhausted: q.Exhausted,
+		}
+
+		// unknown values are reported as nulls
+		if q.Limit >= 0 {
+			item.Limit = &q.Limit
+		}
+		if q.Remaining >= 0 {
+			item.Remaining = &q.Remaining
+		}
+		if !q.ResetAt.IsZero() {
+			item.ResetAt = &q.ResetAt
+		}
+
+		resp = append(resp, item)
+	}
+
+	h.newResponse(w, r, http.StatusOK, resp)
+}
@@ -6,7 +6,11 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/client"
+	"github.com/HeadGardener/effective_mobile/internal/logger"
 	"github.com/HeadGardener/effective_mobile/internal/services"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
 )
 
 type response struct {
@@ -14,25 +18,26 @@ type response struct {
 	Error string `json:"Error"`
 }
 
-func (h *Handler) newErrResponse(w http.ResponseWriter, code int, msg string, err error) {
-	h.log.Error(msg, "error", err.Error())
+func (h *Handler) newErrResponse(w http.ResponseWriter, r *http.Request, code int, msg string, err error) {
+	h.log.ErrorContext(r.Context(), msg, "error", err.Error())
 
 	if !errIsCustom(err) && code >= http.StatusInternalServerError {
-		h.newResponse(w, code, response{
+		h.newResponse(w, r, code, response{
 			Msg:   msg,
 			Error: "unexpected error",
 		})
 		return
 	}
 
-	h.newResponse(w, code, response{
+	h.newResponse(w, r, code, response{
 		Msg:   msg,
 		Error: err.Error(),
 	})
 }
 
-func (h *Handler) newResponse(w http.ResponseWriter, code int, data any) {
-	h.log.Info("sending response", "status", code, "data", data)
+func (h *Handler) newResponse(w http.ResponseWriter, r *http.Request, code int, data any) {
+	h.log.InfoContext(r.Context(), "sending response", "status", code, logger.PII("data", data))
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(data)
 }
@@ -42,9 +47,62 @@ func errIsCustom(err error) bool {
 		return true
 	}
 
-	if errors.Is(err, services.ErrPersonNotExist) {
+	if errors.Is(err, services.ErrPersonNotExist) || errors.Is(err, services.ErrPersonDuplicate) ||
+		errors.Is(err, tenant.ErrQuotaExceeded) || errors.Is(err, client.ErrQuotaExhausted) {
+		return true
+	}
+
+	if errors.Is(err, errOverloaded) {
+		return true
+	}
+
+	if errors.Is(err, services.ErrAPIKeyNotExist) || errors.Is(err, services.ErrInvalidAPIKey) ||
+		errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrInvalidCertificate) {
 		return true
 	}
 
 	return false
 }
+
+// statusFromErr returns 404 for missing persons, 409 for duplicates rejected by policy, 403 for exceeded
+// tenant quota, 503 for exhausted quota of enrichment apis and 500 for everything else.
+func statusFromErr(err error) int {
+	if errors.Is(err, services.ErrPersonDuplicate) {
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, client.ErrQuotaExhausted) {
+		return http.StatusServiceUnavailable
+	}
+
+	if errors.Is(err, tenant.ErrQuotaExceeded) {
+		return http.StatusForbidden
+	}
+
+	if errors.Is(err, services.ErrPersonNotExist) || errors.Is(err, services.ErrAPIKeyNotExist) ||
+		errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
+
+// statusFromBodyErr returns 413 if request body is longer than its limit and 400 otherwise.
+func statusFromBodyErr(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
+
+// statusFromAuthErr returns 401 for rejected credentials and 500 for failures of auth backend.
+func statusFromAuthErr(err error) int {
+	if errors.Is(err, services.ErrInvalidAPIKey) || errors.Is(err, auth.ErrInvalidToken) ||
+		errors.Is(err, auth.ErrInvalidCertificate) {
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,249 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+)
+
+// Component is a part of the service started and stopped by Manager, every hook is optional.
+type Component struct {
+	Name string
+	// DependsOn names components started before and stopped after this one.
+	DependsOn []string
+	// Start prepares component, components are started one by one, so it must not block.
+	Start func(ctx context.Context) error
+	// Run works until ctx is canceled or Stop is called, error returned before that stops the service.
+	Run func(ctx context.Context) error
+	// Stop is called after ctx of Run is canceled, Run must return by the time Stop returns.
+	Stop func(ctx context.Context) error
+	// StopTimeout overrides SHUTDOWN_TIMEOUT for the component.
+	StopTimeout time.Duration
+}
+
+// Manager starts components in order of their dependencies and stops them in reverse order.
+type Manager struct {
+	log         *slog.Logger
+	drainDelay  time.Duration
+	stopTimeout time.Duration
+	components  []Component
+	drainHooks  []func()
+}
+
+func NewManager(conf config.ServerConfig, log *slog.Logger) *Manager {
+	return &Manager{
+		log:         log,
+		drainDelay:  conf.DrainDelay,
+		stopTimeout: conf.ShutdownTimeout,
+	}
+}
+
+func (m *Manager) Add(c Component) {
+	m.components = append(m.components, c)
+}
+
+// OnDrain registers hook called as soon as shutdown begins, before any component is stopped,
+// e.g. to fail readiness.
+func (m *Manager) OnDrain(hook func()) {
+	m.drainHooks = append(m.drainHooks, hook)
+}
+
+type running struct {
+	Component
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Run starts components and stops them when ctx is done or any component fails. Returned error
+// tells which component failed and which ones failed to stop or blocked shutdown.
+func (m *Manager) Run(ctx context.Context) error {
+	order, err := m.order()
+	if err != nil {
+		return err
+	}
+
+	failed := make(chan error, len(order))
+	started := make([]*running, 0, len(order))
+
+	for _, c := range order {
+		if c.Start != nil {
+			if err = c.Start(ctx); err != nil {
+				err = fmt.Errorf("failed to start %s: %w", c.Name, err)
+				return errors.Join(err, m.stop(started))
+			}
+		}
+
+		// components outlive ctx, they are stopped one by one
+		runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		r := &running{Component: c, ctx: runCtx, cancel: cancel, done: make(chan struct{})}
+		started = append(started, r)
+
+		go m.run(r, failed)
+		m.log.Info("component started", "component", c.Name)
+	}
+
+	select {
+	case <-ctx.Done():
+		m.log.Info("shutting down")
+	case err = <-failed:
+		m.log.Error("shutting down on failure", "error", err.Error())
+	}
+
+	for _, hook := range m.drainHooks {
+		hook()
+	}
+
+	// there is no point to wait for load balancer if service is already broken
+	if err == nil && m.drainDelay > 0 {
+		m.log.Info("draining", "delay", m.drainDelay.String())
+		time.Sleep(m.drainDelay)
+	}
+
+	return errors.Join(err, m.stop(started))
+}
+
+func (m *Manager) run(r *running, failed chan<- error) {
+	defer close(r.done)
+
+	if r.Run == nil {
+		return
+	}
+
+	err := r.Run(r.ctx)
+	switch {
+	case err == nil:
+	case r.ctx.Err() == nil:
+		failed <- fmt.Errorf("%s failed: %w", r.Name, err)
+	default:
+		m.log.Error("component failed while stopping", "component", r.Name, "error", err.Error())
+	}
+}
+
+// stop stops started components in reverse order, component blocking shutdown is given up on
+// after its timeout, so that the rest are stopped anyway.
+func (m *Manager) stop(started []*running) error {
+	var errs []error
+
+	for i := len(started) - 1; i >= 0; i-- {
+		if err := m.stopComponent(started[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *Manager) stopComponent(r *running) error {
+	timeout := r.StopTimeout
+	if timeout == 0 {
+		timeout = m.stopTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	r.cancel()
+
+	stopped := make(chan error, 1)
+	go func() {
+		if r.Stop == nil {
+			stopped <- nil
+			return
+		}
+		stopped <- r.Stop(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err == nil {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		m.log.Error("component blocked shutdown", "component", r.Name, "timeout", timeout.String())
+		return fmt.Errorf("%s blocked shutdown for %s", r.Name, timeout)
+	}
+
+	if err != nil {
+		m.log.Error("failed to stop component", "component", r.Name, "error", err.Error())
+		return fmt.Errorf("failed to stop %s: %w", r.Name, err)
+	}
+
+	m.log.Info("component stopped", "component", r.Name, "duration", time.Since(start).String())
+	return nil
+}
+
+// order sorts components so that every one follows its dependencies, otherwise components keep
+// order they were added in.
+func (m *Manager) order() ([]Component, error) {
+	byName := make(map[string]Component, len(m.components))
+	for _, c := range m.components {
+		if _, ok := byName[c.Name]; ok {
+			return nil, fmt.Errorf("component %s is added twice", c.Name)
+		}
+		byName[c.Name] = c
+	}
+
+	for _, c := range m.components {
+		for _, dep := range c.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("%s depends on unknown component %s", c.Name, dep)
+			}
+		}
+	}
+
+	// components not visited yet have zero state
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	var (
+		state = make(map[string]int, len(m.components))
+		order = make([]Component, 0, len(m.components))
+		visit func(c Component) error
+	)
+
+	visit = func(c Component) error {
+		switch state[c.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle through %s", c.Name)
+		}
+
+		state[c.Name] = visiting
+		for _, dep := range c.DependsOn {
+			if err := visit(byName[dep]); err != nil {
+				return err
+			}
+		}
+		state[c.Name] = visited
+		order = append(order, c)
+
+		return nil
+	}
+
+	for _, c := range m.components {
+		if err := visit(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
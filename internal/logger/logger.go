@@ -0,0 +1,163 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+
+	requestIDKey = "request_id"
+	traceIDKey   = "trace_id"
+	redacted     = "[REDACTED]"
+)
+
+// New builds logger from conf, every component of the service gets it injected. Request ID and trace ID
+// are taken from context, so *Context methods of the logger must be used while handling requests.
+// Level is kept in level, so that it can be changed with SetLevel while running.
+func New(conf config.LoggerConfig, level *slog.LevelVar) (*slog.Logger, error) {
+	if err := SetLevel(level, conf.Level); err != nil {
+		return nil, err
+	}
+
+	out, err := openOutput(conf.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	switch conf.Format {
+	case FormatJSON, "":
+		h = slog.NewJSONHandler(out, opts)
+	case FormatText:
+		h = slog.NewTextHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, it must be json or text", conf.Format)
+	}
+
+	h = &contextHandler{next: h, allowPII: conf.PII}
+
+	if conf.SamplingInitial > 0 {
+		h = newSamplingHandler(h, conf.SamplingInitial, conf.SamplingThereafter)
+	}
+
+	return slog.New(h), nil
+}
+
+func SetLevel(level *slog.LevelVar, name string) error {
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("invalid log level %q", name)
+	}
+
+	return nil
+}
+
+func openOutput(output string) (io.Writer, error) {
+	switch output {
+	case OutputStdout, "":
+		return os.Stdout, nil
+	case OutputStderr:
+		return os.Stderr, nil
+	default:
+		f, err := os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log output: %w", err)
+		}
+		return f, nil
+	}
+}
+
+type requestIDCtxKey struct{}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// pii is a value which is logged only if PII logging is enabled.
+type pii struct {
+	value any
+}
+
+// PII marks attribute holding personal data, such as person names or urls with them.
+func PII(key string, value any) slog.Attr {
+	return slog.Any(key, pii{value: value})
+}
+
+// contextHandler adds request ID and trace ID from context to records and redacts PII.
+type contextHandler struct {
+	next     slog.Handler
+	allowPII bool
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	record := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+
+	r.Attrs(func(a slog.Attr) bool {
+		record.AddAttrs(h.redact(a))
+		return true
+	})
+
+	if id := RequestIDFrom(ctx); id != "" {
+		record.AddAttrs(slog.String(requestIDKey, id))
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		record.AddAttrs(slog.String(traceIDKey, sc.TraceID().String()))
+	}
+
+	return h.next.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redactedAttrs = append(redactedAttrs, h.redact(a))
+	}
+
+	return &contextHandler{next: h.next.WithAttrs(redactedAttrs), allowPII: h.allowPII}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{next: h.next.WithGroup(name), allowPII: h.allowPII}
+}
+
+func (h *contextHandler) redact(a slog.Attr) slog.Attr {
+	switch v := a.Value.Any().(type) {
+	case pii:
+		if h.allowPII {
+			return slog.Any(a.Key, v.value)
+		}
+		return slog.String(a.Key, redacted)
+	case []slog.Attr:
+		group := make([]any, 0, len(v))
+		for _, item := range v {
+			group = append(group, h.redact(item))
+		}
+		return slog.Group(a.Key, group...)
+	}
+
+	return a
+}
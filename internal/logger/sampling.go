@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const samplingTick = time.Second
+
+// samplingHandler passes first initial records with the same message and level every second and then
+// every thereafter-th of them, dropping the rest. Warnings and errors are never dropped.
+type samplingHandler struct {
+	next       slog.Handler
+	initial    int
+	thereafter int
+
+	state *samplingState
+}
+
+type samplingState struct {
+	mu     sync.Mutex
+	tick   time.Time
+	counts map[samplingKey]int
+}
+
+type samplingKey struct {
+	level slog.Level
+	msg   string
+}
+
+func newSamplingHandler(next slog.Handler, initial, thereafter int) *samplingHandler {
+	return &samplingHandler{
+		next:       next,
+		initial:    initial,
+		thereafter: thereafter,
+		state: &samplingState{
+			counts: make(map[samplingKey]int),
+		},
+	}
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn || h.state.keep(samplingKey{level: r.Level, msg: r.Message}, r.Time,
+		h.initial, h.thereafter) {
+		return h.next.Handle(ctx, r)
+	}
+
+	return nil
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{next: h.next.WithAttrs(attrs), initial: h.initial, thereafter: h.thereafter,
+		state: h.state}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{next: h.next.WithGroup(name), initial: h.initial, thereafter: h.thereafter,
+		state: h.state}
+}
+
+func (s *samplingState) keep(key samplingKey, now time.Time, initial, thereafter int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tick := now.Truncate(samplingTick); !tick.Equal(s.tick) {
+		s.tick = tick
+		clear(s.counts)
+	}
+
+	s.counts[key]++
+	n := s.counts[key]
+
+	if n <= initial {
+		return true
+	}
+
+	return thereafter > 0 && (n-initial)%thereafter == 0
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "effective_mobile"
+
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+// Registry holds every metric of the service, collectors are package level, so that storages
+// and clients don't need it to be passed around.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of http requests by route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpRequestsShed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_shed_total",
+		Help:      "Http requests rejected because too many requests were served at once.",
+	})
+
+	upstreamRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Duration of requests to enrichment apis by status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"upstream", "status"})
+
+	upstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Failed requests to enrichment apis by reason.",
+	}, []string{"upstream", "reason"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of db queries by query name and status.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query", "status"})
+
+	dbReplicaLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_replica_lag_seconds",
+		Help:      "Replication lag of read replicas, -1 if replica is unreachable.",
+	}, []string{"replica"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		httpRequestsShed,
+		upstreamRequestDuration,
+		upstreamErrors,
+		dbQueryDuration,
+		dbReplicaLag,
+	)
+}
+
+// Handler serves metrics in prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exposes pool stats of db.
+func RegisterDB(db *sql.DB, name string) error {
+	err := Registry.Register(collectors.NewDBStatsCollector(db, name))
+
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		return nil
+	}
+
+	return err
+}
+
+func ObserveHTTPRequest(method, route string, status int, start time.Time) {
+	httpRequestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+}
+
+func IncHTTPRequestShed() {
+	httpRequestsShed.Inc()
+}
+
+// ObserveUpstreamRequest records request to enrichment api, status is zero if response wasn't received.
+func ObserveUpstreamRequest(upstream string, status int, start time.Time) {
+	label := strconv.Itoa(status)
+	if status == 0 {
+		label = statusError
+	}
+
+	upstreamRequestDuration.WithLabelValues(upstream, label).Observe(time.Since(start).Seconds())
+}
+
+func IncUpstreamError(upstream, reason string) {
+	upstreamErrors.WithLabelValues(upstream, reason).Inc()
+}
+
+// ObserveDBQuery records query started at start, sql.ErrNoRows isn't counted as an error.
+func ObserveDBQuery(query string, start time.Time, err error) {
+	status := statusOK
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		status = statusError
+	}
+
+	dbQueryDuration.WithLabelValues(query, status).Observe(time.Since(start).Seconds())
+}
+
+// SetDBReplicaLag records lag of replica, negative lag means that replica is unreachable.
+func SetDBReplicaLag(replica string, lag time.Duration) {
+	dbReplicaLag.WithLabelValues(replica).Set(lag.Seconds())
+}
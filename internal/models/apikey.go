@@ -0,0 +1,19 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type APIKey struct {
+	ID     string `db:"id"`
+	Name   string `db:"name"`
+	Prefix string `db:"prefix"`
+	// TenantID is tenant whose persons are available with the key.
+	TenantID string `db:"tenant_id"`
+	// Hash is sha256 of the key, plain key is shown only once on creation.
+	Hash      string       `db:"key_hash"`
+	Scopes    string       `db:"scopes"`
+	CreatedAt time.Time    `db:"created_at"`
+	RevokedAt sql.NullTime `db:"revoked_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// DBHealth is state of db as seen by the service, Error is empty if db is reachable.
+type DBHealth struct {
+	Reachable         bool
+	Latency           time.Duration
+	PendingMigrations int
+	Error             string
+}
+
+// UpstreamHealth is reachability of enrichment api, any http response means it is reachable.
+type UpstreamHealth struct {
+	Upstream  string
+	Reachable bool
+	Latency   time.Duration
+	Error     string
+}
+
+type HealthDetails struct {
+	Ready     bool
+	Draining  bool
+	DB        DBHealth
+	Upstreams []UpstreamHealth
+}
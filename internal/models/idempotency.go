@@ -0,0 +1,22 @@
+package models
+
+import "net/http"
+
+// IdempotencyKey is Idempotency-Key of a request, keys are scoped by tenant and principal, so that
+// clients can't replay responses of each other.
+type IdempotencyKey struct {
+	TenantID    string
+	PrincipalID string
+	Key         string
+}
+
+// IdempotencyRecord is a request made with IdempotencyKey and response to it.
+type IdempotencyRecord struct {
+	// Fingerprint is a hash of the request, key reused for another request is rejected.
+	Fingerprint string `db:"fingerprint"`
+	// StatusCode is zero while the first request is in progress.
+	StatusCode int    `db:"status_code"`
+	Response   []byte `db:"response"`
+	// Headers are response headers replayed along with the response.
+	Headers http.Header `db:"-"`
+}
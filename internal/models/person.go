@@ -11,4 +11,44 @@ type Person struct {
 	Gender      string    `db:"gender"`
 	Nationality string    `db:"nationality"`
 	CreatedAt   time.Time `db:"created_at"`
+	// TenantID is set from the principal by storage and isn't exposed to clients.
+	TenantID string `db:"tenant_id" json:"-"`
+	// NormalizedName is lowercased full name with collapsed spaces, it is computed by postgres
+	// and identifies duplicates.
+	NormalizedName string `db:"normalized_name" json:"-"`
 }
+
+// DuplicatePair is a pair of persons with similar normalized names.
+type DuplicatePair struct {
+	ID          string  `db:"id"`
+	DuplicateID string  `db:"duplicate_id"`
+	Similarity  float64 `db:"similarity"`
+}
+
+// DuplicateCluster is a group of persons linked by similar names, Similarity is the highest
+// similarity of its pairs.
+type DuplicateCluster struct {
+	Persons    []Person
+	Similarity float64
+}
+
+// PersonMerge is an audit record of source person merged into target, both are snapshots
+// taken before merge.
+type PersonMerge struct {
+	ID       string    `db:"id"`
+	TenantID string    `db:"tenant_id"`
+	TargetID string    `db:"target_id"`
+	SourceID string    `db:"source_id"`
+	Target   []byte    `db:"target"`
+	Source   []byte    `db:"source"`
+	MergedBy string    `db:"merged_by"`
+	MergedAt time.Time `db:"merged_at"`
+}
+
+// Order is an order in which persons are sorted by (created_at, id).
+type Order string
+
+const (
+	OrderDesc Order = "desc"
+	OrderAsc  Order = "asc"
+)
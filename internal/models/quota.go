@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UpstreamQuota is a state of request quota of enrichment api, Limit and Remaining are -1 until
+// the api reports them.
+type UpstreamQuota struct {
+	Upstream  string
+	Mode      string
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+	// Exhausted means that only reserve is left, so requests are queued or skipped depending on Mode.
+	Exhausted bool
+}
@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+)
+
+const (
+	readSuffix  = ":read"
+	writeSuffix = ":write"
+)
+
+// Limit is a token bucket refilled with Rate tokens per second up to Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// fillTime is time in which empty bucket gets full.
+func (l Limit) fillTime() time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// Bucket is a state of token bucket as it is kept by stores.
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Result is an outcome of taking a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is time until the next token, zero if request is allowed.
+	RetryAfter time.Duration
+	// Reset is time until bucket gets full.
+	Reset time.Duration
+}
+
+// Take refills bucket for the time passed since its last update and takes one token from it if there is any.
+// Zero bucket is treated as a full one.
+func (b Bucket) Take(limit Limit, now time.Time) (Bucket, Result) {
+	tokens := float64(limit.Burst)
+	if !b.UpdatedAt.IsZero() {
+		elapsed := now.Sub(b.UpdatedAt).Seconds()
+		tokens = math.Min(float64(limit.Burst), b.Tokens+math.Max(elapsed, 0)*limit.Rate)
+	}
+
+	res := Result{
+		Limit: limit.Burst,
+	}
+
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else if limit.Rate > 0 {
+		res.RetryAfter = time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	}
+
+	res.Remaining = int(tokens)
+	if limit.Rate > 0 {
+		res.Reset = time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second))
+	}
+
+	return Bucket{Tokens: tokens, UpdatedAt: now}, res
+}
+
+// Store keeps buckets by key, Take must be atomic for a key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	// DeleteIdle deletes buckets not updated since before, they are full anyway.
+	DeleteIdle(ctx context.Context, before time.Time) error
+}
+
+// Limiter limits reads and writes of every client separately.
+type Limiter struct {
+	log   *slog.Logger
+	store Store
+
+	limits atomic.Pointer[limits]
+}
+
+type limits struct {
+	read  Limit
+	write Limit
+}
+
+func NewLimiter(conf config.RateLimitConfig, log *slog.Logger, store Store) *Limiter {
+	l := &Limiter{
+		log:   log,
+		store: store,
+	}
+	l.SetLimits(conf)
+
+	return l
+}
+
+// SetLimits replaces limits of reads and writes at once, buckets keep their tokens.
+func (l *Limiter) SetLimits(conf config.RateLimitConfig) {
+	l.limits.Store(&limits{
+		read: Limit{
+			Rate:  float64(conf.ReadPerMinute) / 60,
+			Burst: conf.ReadBurst,
+		},
+		write: Limit{
+			Rate:  float64(conf.WritePerMinute) / 60,
+			Burst: conf.WriteBurst,
+		},
+	})
+}
+
+// Allow takes a token from read or write bucket of client identified by key.
+func (l *Limiter) Allow(ctx context.Context, key string, write bool) (Result, error) {
+	lim := l.limits.Load()
+	if write {
+		return l.store.Take(ctx, key+writeSuffix, lim.write, time.Now())
+	}
+
+	return l.store.Take(ctx, key+readSuffix, lim.read, time.Now())
+}
+
+// Run deletes idle buckets every interval until ctx is done.
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lim := l.limits.Load()
+			idle := max(lim.read.fillTime(), lim.write.fillTime())
+			if err := l.store.DeleteIdle(ctx, time.Now().Add(-idle)); err != nil {
+				l.log.ErrorContext(ctx, "failed to delete idle rate limit buckets", "error", err.Error())
+			}
+		}
+	}
+}
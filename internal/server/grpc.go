@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type GRPCServer struct {
+	grpcServer *grpc.Server
+	port       string
+}
+
+// NewGRPCServer builds server with newServer, e.g. grpchandlers.Handler.InitServer. If certificate is configured,
+// server uses the same tls config as http server, so certificates are reloaded and client certificates are verified
+// in the same way.
+func NewGRPCServer(conf config.GRPCConfig, serverConf config.ServerConfig, newServer func(...grpc.ServerOption) *grpc.Server,
+	log *slog.Logger) (*GRPCServer, error) {
+	var opts []grpc.ServerOption
+	if serverConf.TLSCertFile != "" {
+		tlsConfig, err := newTLSConfig(serverConf, log)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	return &GRPCServer{
+		grpcServer: newServer(opts...),
+		port:       conf.Port,
+	}, nil
+}
+
+// Run returns nil once server is stopped, including stops before Run.
+func (s *GRPCServer) Run() error {
+	lis, err := net.Listen("tcp", ":"+s.port)
+	if err != nil {
+		return err
+	}
+
+	if err = s.grpcServer.Serve(lis); errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown waits for in-flight rpcs to finish and forcibly stops the server if ctx is done earlier.
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
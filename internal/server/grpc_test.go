@@ -0,0 +1,205 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/grpchandlers"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/server"
+	personv1 "github.com/HeadGardener/effective_mobile/pkg/api/person/v1"
+)
+
+type grpcPersonService struct {
+	grpchandlers.PersonService
+}
+
+func (grpcPersonService) GetByID(_ context.Context, id string) (*models.Person, error) {
+	return &models.Person{ID: id, Name: "Ivan"}, nil
+}
+
+// testCA issues certificates signed by a throwaway CA.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key := generateKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create ca certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse ca certificate: %s", err)
+	}
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate) tls.Certificate {
+	t.Helper()
+
+	key := generateKey(t)
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func generateKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+
+	return key
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+}
+
+func TestGRPCIsServedOverTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, &x509.Certificate{
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientCert := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "reporter", OrganizationalUnit: []string{string(auth.ScopePersonsRead)}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	dir := t.TempDir()
+	serverConf := config.ServerConfig{
+		TLSCertFile:     filepath.Join(dir, "server.crt"),
+		TLSKeyFile:      filepath.Join(dir, "server.key"),
+		TLSClientCAFile: filepath.Join(dir, "ca.crt"),
+		TLSMinVersion:   "1.2",
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(serverCert.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %s", err)
+	}
+	writePEM(t, serverConf.TLSCertFile, "CERTIFICATE", serverCert.Certificate[0])
+	writePEM(t, serverConf.TLSKeyFile, "PRIVATE KEY", keyDER)
+	writePEM(t, serverConf.TLSClientCAFile, "CERTIFICATE", ca.cert.Raw)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := grpchandlers.NewHandler(config.HandlerConfig{AuthEnabled: true}, log, grpcPersonService{}, nil)
+
+	grpcConf := config.GRPCConfig{Port: freePort(t)}
+	srv, err := server.NewGRPCServer(grpcConf, serverConf, h.InitServer, log)
+	if err != nil {
+		t.Fatalf("failed to build grpc server: %s", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Run() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if shutdownErr := srv.Shutdown(ctx); shutdownErr != nil {
+			t.Errorf("failed to shut down grpc server: %s", shutdownErr)
+		}
+		if runErr := <-done; runErr != nil {
+			t.Errorf("grpc server failed: %s", runErr)
+		}
+	})
+
+	addr := "127.0.0.1:" + grpcConf.Port
+	waitListening(t, addr)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	tests := []struct {
+		name  string
+		creds credentials.TransportCredentials
+		want  codes.Code
+	}{
+		{
+			name:  "client certificate",
+			creds: credentials.NewTLS(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}}),
+			want:  codes.OK,
+		},
+		{
+			name:  "without client certificate",
+			creds: credentials.NewTLS(&tls.Config{RootCAs: roots}),
+			want:  codes.Unauthenticated,
+		},
+		{
+			name:  "plaintext",
+			creds: insecure.NewCredentials(),
+			want:  codes.Unavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		conn, dialErr := grpc.Dial(addr, grpc.WithTransportCredentials(tt.creds))
+		if dialErr != nil {
+			t.Fatalf("%s: failed to dial: %s", tt.name, dialErr)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		person, callErr := personv1.NewPersonServiceClient(conn).GetByID(ctx, &personv1.GetByIDRequest{Id: personID})
+		cancel()
+		conn.Close()
+
+		if code := status.Code(callErr); code != tt.want {
+			t.Errorf("%s: expected code %s, got %v", tt.name, tt.want, callErr)
+			continue
+		}
+		if tt.want == codes.OK && person.GetName() != "Ivan" {
+			t.Errorf("%s: unexpected person %v", tt.name, person)
+		}
+	}
+}
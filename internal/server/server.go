@@ -2,26 +2,66 @@ package server
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net/http"
-	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/HeadGardener/effective_mobile/internal/config"
 )
 
 type Server struct {
 	httpServer *http.Server
+	tls        bool
+}
+
+// NewServer builds server before it is run, so that it can be shut down at any moment. Server uses https
+// if certificate is configured, and plain http otherwise. Plain http is upgraded to HTTP/2 with h2c if it
+// is enabled.
+func NewServer(conf config.ServerConfig, handler http.Handler, log *slog.Logger) (*Server, error) {
+	httpServer := &http.Server{
+		Addr:              ":" + conf.Port,
+		Handler:           handler,
+		MaxHeaderBytes:    conf.MaxHeaderBytes,
+		ReadTimeout:       conf.ReadTimeout,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+	}
+
+	if conf.TLSCertFile == "" {
+		if conf.H2C {
+			httpServer.Handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: conf.IdleTimeout})
+		}
+		return &Server{httpServer: httpServer}, nil
+	}
+
+	tlsConfig, err := newTLSConfig(conf, log)
+	if err != nil {
+		return nil, err
+	}
+	httpServer.TLSConfig = tlsConfig
+
+	return &Server{httpServer: httpServer, tls: true}, nil
 }
 
-func (s *Server) Run(conf config.ServerConfig, handler http.Handler) error {
-	s.httpServer = &http.Server{
-		Addr:           ":" + conf.Port,
-		Handler:        handler,
-		MaxHeaderBytes: 1 << 20,
-		ReadTimeout:    conf.ReadTimeout * time.Second,
-		WriteTimeout:   conf.WriteTimeout * time.Second,
+// Run returns nil once server is shut down, including shutdowns before Run.
+func (s *Server) Run() error {
+	if !s.tls {
+		return ignoreClosed(s.httpServer.ListenAndServe())
 	}
 
-	return s.httpServer.ListenAndServe()
+	// certificates are provided by tls config
+	return ignoreClosed(s.httpServer.ListenAndServeTLS("", ""))
+}
+
+func ignoreClosed(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
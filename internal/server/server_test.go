@@ -0,0 +1,199 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/handlers"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/server"
+)
+
+const personID = "3f8d5a52-5c2a-4a4e-9d2b-1c6f0f4f5b7e"
+
+// blockingPersonService holds GetByID until release is closed, so that requests stay in flight.
+type blockingPersonService struct {
+	handlers.PersonService
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingPersonService) GetByID(context.Context, string) (*models.Person, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return &models.Person{ID: personID}, nil
+}
+
+func newTestServer(t *testing.T, serverConf config.ServerConfig, handlerConf config.HandlerConfig,
+	personService handlers.PersonService) (string, *http.Client) {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := handlers.NewHandler(handlerConf, log, personService, nil, nil, nil, nil, nil, nil)
+
+	serverConf.Port = freePort(t)
+	srv, err := server.NewServer(serverConf, h.InitRoutes(), log)
+	if err != nil {
+		t.Fatalf("failed to build server: %s", err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{}}
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Run() }()
+	t.Cleanup(func() {
+		// connections dialed by transport but never used would be waited for by Shutdown
+		client.CloseIdleConnections()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if shutdownErr := srv.Shutdown(ctx); shutdownErr != nil {
+			t.Errorf("failed to shut down server: %s", shutdownErr)
+		}
+		if runErr := <-done; runErr != nil {
+			t.Errorf("server failed: %s", runErr)
+		}
+	})
+
+	addr := "127.0.0.1:" + serverConf.Port
+	waitListening(t, addr)
+
+	return addr, client
+}
+
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find free port: %s", err)
+	}
+	defer lis.Close()
+
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	return port
+}
+
+func waitListening(t *testing.T, addr string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server isn't listening: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSlowHeadersAreCutOff(t *testing.T) {
+	addr, _ := newTestServer(t, config.ServerConfig{ReadHeaderTimeout: 100 * time.Millisecond},
+		config.HandlerConfig{}, nil)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	defer conn.Close()
+
+	// slowloris client sends headers byte by byte and never finishes them
+	if _, err = conn.Write([]byte("GET /healthz HTTP/1.1\r\nHost: localhost\r\n")); err != nil {
+		t.Fatalf("failed to write headers: %s", err)
+	}
+
+	start := time.Now()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(make([]byte, 1))
+	if n != 0 || err == nil {
+		t.Fatalf("expected connection to be closed, got %d bytes and error %v", n, err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatal("connection with unfinished headers wasn't closed by server")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("connection was closed after %s", elapsed)
+	}
+}
+
+func TestOversizedBodyIsRejected(t *testing.T) {
+	addr, client := newTestServer(t, config.ServerConfig{ReadHeaderTimeout: time.Second},
+		config.HandlerConfig{MaxBodyBytes: 1 << 10}, nil)
+
+	resp, err := client.Post("http://"+addr+"/api/", "application/json", bytes.NewReader(make([]byte, 2<<10)))
+	if err != nil {
+		t.Fatalf("failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+}
+
+func TestRequestsAboveConcurrencyLimitAreShed(t *testing.T) {
+	personService := &blockingPersonService{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	addr, client := newTestServer(t, config.ServerConfig{ReadHeaderTimeout: time.Second},
+		config.HandlerConfig{MaxBodyBytes: 1 << 10, MaxConcurrentRequests: 1}, personService)
+	url := "http://" + addr + "/api/" + personID
+
+	firstResp := make(chan *http.Response, 1)
+	go func() {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Errorf("failed to send first request: %s", err)
+			close(firstResp)
+			return
+		}
+		firstResp <- resp
+	}()
+	<-personService.started
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("failed to send second request: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After header")
+	}
+
+	// probes are never shed
+	probe, err := client.Get("http://" + addr + "/healthz")
+	if err != nil {
+		t.Fatalf("failed to send probe: %s", err)
+	}
+	probe.Body.Close()
+	if probe.StatusCode != http.StatusOK {
+		t.Fatalf("expected probe status %d, got %d", http.StatusOK, probe.StatusCode)
+	}
+
+	close(personService.release)
+	if first := <-firstResp; first != nil {
+		first.Body.Close()
+		if first.StatusCode != http.StatusOK {
+			t.Fatalf("expected first request status %d, got %d", http.StatusOK, first.StatusCode)
+		}
+	}
+}
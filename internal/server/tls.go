@@ -0,0 +1,167 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+)
+
+// certCheckInterval is how often handshakes check whether certificate files were rotated.
+const certCheckInterval = 10 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certLoader keeps server certificate and client CA pool, reloading them after files change.
+// Failed reload keeps the previous ones, so that half written files don't break handshakes.
+type certLoader struct {
+	log *slog.Logger
+
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	modTimes  []time.Time
+
+	certs atomic.Pointer[loadedCerts]
+}
+
+type loadedCerts struct {
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// newTLSConfig builds config serving certificate from conf, client certificates are verified if client CA is set.
+func newTLSConfig(conf config.ServerConfig, log *slog.Logger) (*tls.Config, error) {
+	loader := &certLoader{
+		log:          log,
+		certFile:     conf.TLSCertFile,
+		keyFile:      conf.TLSKeyFile,
+		clientCAFile: conf.TLSClientCAFile,
+	}
+
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+
+	clientAuth := tls.NoClientCert
+	if conf.TLSClientCAFile != "" {
+		clientAuth = tls.VerifyClientCertIfGiven
+		if conf.TLSClientAuth == config.TLSClientAuthRequire {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	minVersion := tlsVersions[conf.TLSMinVersion]
+
+	return &tls.Config{
+		MinVersion: minVersion,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return loader.current().cert, nil
+		},
+		// config is built per connection, so that rotated client CA is used by new connections
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			certs := loader.current()
+			return &tls.Config{
+				MinVersion:   minVersion,
+				Certificates: []tls.Certificate{*certs.cert},
+				ClientCAs:    certs.clientCAs,
+				ClientAuth:   clientAuth,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}, nil
+}
+
+// current returns loaded certificates, reloading them first if files were modified.
+func (l *certLoader) current() *loadedCerts {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.checkedAt) < certCheckInterval {
+		return l.certs.Load()
+	}
+	l.checkedAt = time.Now()
+
+	modTimes, err := l.statFiles()
+	if err != nil || !l.modified(modTimes) {
+		return l.certs.Load()
+	}
+
+	if err = l.load(); err != nil {
+		l.log.Error("failed to reload tls certificates, keeping previous ones", "error", err.Error())
+	}
+
+	return l.certs.Load()
+}
+
+func (l *certLoader) load() error {
+	modTimes, err := l.statFiles()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	certs := &loadedCerts{cert: &cert}
+
+	if l.clientCAFile != "" {
+		pem, readErr := os.ReadFile(l.clientCAFile)
+		if readErr != nil {
+			return fmt.Errorf("failed to read client ca: %w", readErr)
+		}
+
+		certs.clientCAs = x509.NewCertPool()
+		if !certs.clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("client ca file contains no certificates")
+		}
+	}
+
+	l.certs.Store(certs)
+	l.modTimes = modTimes
+
+	return nil
+}
+
+func (l *certLoader) statFiles() ([]time.Time, error) {
+	files := []string{l.certFile, l.keyFile}
+	if l.clientCAFile != "" {
+		files = append(files, l.clientCAFile)
+	}
+
+	modTimes := make([]time.Time, 0, len(files))
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	return modTimes, nil
+}
+
+func (l *certLoader) modified(modTimes []time.Time) bool {
+	for i := range modTimes {
+		if !modTimes[i].Equal(l.modTimes[i]) {
+			return true
+		}
+	}
+
+	return false
+}
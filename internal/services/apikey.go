@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+	"github.com/google/uuid"
+)
+
+const (
+	apiKeyPrefix    = "em_"
+	apiKeyBytes     = 32
+	apiKeyPrefixLen = 11
+
+	bootstrapPrincipalID = "bootstrap"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid or revoked api key")
+	ErrAPIKeyNotExist = errors.New("api key with such id doesn't exists")
+	ErrInvalidScopes  = errors.New("invalid scopes")
+)
+
+type APIKeyStorage interface {
+	Save(ctx context.Context, key *models.APIKey) error
+	GetByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	List(ctx context.Context) ([]models.APIKey, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+type APIKeyService struct {
+	apiKeyStorage APIKeyStorage
+	bootstrapKey  string
+}
+
+func NewAPIKeyService(conf config.AuthConfig, apiKeyStorage APIKeyStorage) *APIKeyService {
+	return &APIKeyService{
+		apiKeyStorage: apiKeyStorage,
+		bootstrapKey:  conf.BootstrapKey,
+	}
+}
+
+// Create generates new key with given scopes for persons of tenantID and returns it in plain text,
+// only its hash is stored.
+func (s *APIKeyService) Create(ctx context.Context,
+	name, tenantID string, scopes []auth.Scope) (string, *models.APIKey, error) {
+	if err := tenant.ValidateID(tenantID); err != nil {
+		return "", nil, err
+	}
+
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidScopes
+	}
+
+	if _, err := auth.ParseScopes(auth.JoinScopes(scopes)); err != nil {
+		return "", nil, errors.Join(ErrInvalidScopes, err)
+	}
+
+	raw := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+
+	plain := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	key := &models.APIKey{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Prefix:    plain[:apiKeyPrefixLen],
+		TenantID:  tenantID,
+		Hash:      hashAPIKey(plain),
+		Scopes:    auth.JoinScopes(scopes),
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.apiKeyStorage.Save(ctx, key); err != nil {
+		return "", nil, err
+	}
+
+	return plain, key, nil
+}
+
+// List returns keys of tenant of ctx.
+func (s *APIKeyService) List(ctx context.Context) ([]models.APIKey, error) {
+	return s.apiKeyStorage.List(ctx)
+}
+
+// Revoke revokes key of tenant of ctx, keys of other tenants don't exist for the caller.
+func (s *APIKeyService) Revoke(ctx context.Context, id string) error {
+	if err := s.apiKeyStorage.Revoke(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAPIKeyNotExist
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Authenticate returns principal owning the key. Bootstrap key from config is granted admin scope
+// in default tenant and is super admin, so that the first keys of every tenant can be created.
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*auth.Principal, error) {
+	if s.bootstrapKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.bootstrapKey)) == 1 {
+		return &auth.Principal{
+			ID:         bootstrapPrincipalID,
+			Name:       bootstrapPrincipalID,
+			Scopes:     []auth.Scope{auth.ScopeAdmin},
+			TenantID:   tenant.Default,
+			SuperAdmin: true,
+		}, nil
+	}
+
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.apiKeyStorage.GetByHash(ctx, hashAPIKey(key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	scopes, err := auth.ParseScopes(apiKey.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Principal{
+		ID:       apiKey.ID,
+		Name:     apiKey.Name,
+		Scopes:   scopes,
+		TenantID: apiKey.TenantID,
+	}, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
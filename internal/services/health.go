@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/models"
+)
+
+const (
+	dbCheckTimeout       = 2 * time.Second
+	upstreamCheckTimeout = 3 * time.Second
+
+	// upstreamCheckTTL is how long results of enrichment apis checks are reused, so that frequent
+	// health requests don't turn into requests to the apis.
+	upstreamCheckTTL = 10 * time.Second
+)
+
+var ErrDraining = errors.New("service is shutting down")
+
+type HealthStorage interface {
+	Ping(ctx context.Context) error
+	PendingMigrations(ctx context.Context) (int, error)
+}
+
+type UpstreamChecker interface {
+	CheckUpstreams(ctx context.Context) []models.UpstreamHealth
+}
+
+type HealthService struct {
+	healthStorage   HealthStorage
+	upstreamChecker UpstreamChecker
+
+	draining atomic.Bool
+
+	upstreamsMu        sync.Mutex
+	upstreamsCheckedAt time.Time
+	upstreams          []models.UpstreamHealth
+}
+
+func NewHealthService(healthStorage HealthStorage, upstreamChecker UpstreamChecker) *HealthService {
+	return &HealthService{
+		healthStorage:   healthStorage,
+		upstreamChecker: upstreamChecker,
+	}
+}
+
+// Drain makes service not ready, it is called as soon as shutdown signal is received.
+func (s *HealthService) Drain() {
+	s.draining.Store(true)
+}
+
+// Ready returns nil if service isn't draining, db is reachable and all migrations are applied.
+// Enrichment apis aren't checked, persons can't be created without them, but everything else works.
+func (s *HealthService) Ready(ctx context.Context) error {
+	if s.draining.Load() {
+		return ErrDraining
+	}
+
+	return dbReady(s.checkDB(ctx))
+}
+
+func (s *HealthService) Details(ctx context.Context) models.HealthDetails {
+	upstreamsCtx, cancel := context.WithTimeout(ctx, upstreamCheckTimeout)
+	defer cancel()
+
+	upstreams := make(chan []models.UpstreamHealth, 1)
+	go func() {
+		upstreams <- s.checkUpstreams(upstreamsCtx)
+	}()
+
+	details := models.HealthDetails{
+		Draining: s.draining.Load(),
+		DB:       s.checkDB(ctx),
+	}
+	details.Ready = !details.Draining && dbReady(details.DB) == nil
+	details.Upstreams = <-upstreams
+
+	return details
+}
+
+// checkUpstreams returns cached results if they are fresh. Concurrent callers wait for the single check.
+func (s *HealthService) checkUpstreams(ctx context.Context) []models.UpstreamHealth {
+	s.upstreamsMu.Lock()
+	defer s.upstreamsMu.Unlock()
+
+	if s.upstreams != nil && time.Since(s.upstreamsCheckedAt) < upstreamCheckTTL {
+		return s.upstreams
+	}
+
+	s.upstreams = s.upstreamChecker.CheckUpstreams(ctx)
+	s.upstreamsCheckedAt = time.Now()
+
+	return s.upstreams
+}
+
+func (s *HealthService) checkDB(ctx context.Context) models.DBHealth {
+	ctx, cancel := context.WithTimeout(ctx, dbCheckTimeout)
+	defer cancel()
+
+	var health models.DBHealth
+
+	start := time.Now()
+	if err := s.healthStorage.Ping(ctx); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Latency = time.Since(start)
+	health.Reachable = true
+
+	pending, err := s.healthStorage.PendingMigrations(ctx)
+	if err != nil {
+		health.Error = fmt.Sprintf("failed to check migrations: %s", err.Error())
+		return health
+	}
+	health.PendingMigrations = pending
+
+	return health
+}
+
+func dbReady(db models.DBHealth) error {
+	if !db.Reachable {
+		return fmt.Errorf("db is unreachable: %s", db.Error)
+	}
+
+	if db.Error != "" {
+		return errors.New(db.Error)
+	}
+
+	if db.PendingMigrations > 0 {
+		return fmt.Errorf("%d migrations are not applied", db.PendingMigrations)
+	}
+
+	return nil
+}
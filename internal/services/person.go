@@ -2,23 +2,44 @@ package services
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/config"
 	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/tracing"
 	"github.com/google/uuid"
 )
 
+var tracer = tracing.Tracer("internal/services")
+
 var (
-	ErrPersonNotExist = errors.New("person with such id doesn't exists")
+	ErrPersonNotExist  = errors.New("person with such id doesn't exists")
+	ErrPersonDuplicate = errors.New("person with the same name already exists")
 )
 
 type PersonStorage interface {
 	Save(ctx context.Context, person *models.Person) (string, error)
 	GetByID(ctx context.Context, id string) (*models.Person, error)
-	Get(ctx context.Context, filters map[string]any, id, createdAt string, limit int) ([]models.Person, error)
-	Delete(ctx context.Context, id string) error
-	Update(ctx context.Context, id string, fields map[string]any) error
+	Get(ctx context.Context, filters map[string]any, id, createdAt string, limit int, order models.Order) ([]models.Person, error)
+	Delete(ctx context.Context, id string) (*models.Person, error)
+	Update(ctx context.Context, id string, fields map[string]any) (*models.Person, error)
+	GetDuplicate(ctx context.Context, person *models.Person) (*models.Person, error)
+	LockName(ctx context.Context, person *models.Person) error
+	GetDuplicatePairs(ctx context.Context, similarity float64, limit int) ([]models.DuplicatePair, error)
+	GetByIDs(ctx context.Context, ids []string) ([]models.Person, error)
+	GetByIDsForUpdate(ctx context.Context, ids []string) ([]models.Person, error)
+	SaveMerges(ctx context.Context, merges []models.PersonMerge) error
+}
+
+// Transactor runs fn in transaction, storages called with ctx passed to fn take part in it.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type PersonDataProvider interface {
@@ -28,59 +49,403 @@ type PersonDataProvider interface {
 }
 
 type PersonService struct {
+	duplicatePolicy     string
+	duplicateSimilarity float64
+
 	personStorage      PersonStorage
 	personDataProvider PersonDataProvider
+	transactor         Transactor
 }
 
-func NewPersonService(personStorage PersonStorage, personDataProvider PersonDataProvider) *PersonService {
+func NewPersonService(conf config.DuplicatesConfig, personStorage PersonStorage,
+	personDataProvider PersonDataProvider, transactor Transactor) *PersonService {
 	return &PersonService{
-		personStorage:      personStorage,
-		personDataProvider: personDataProvider,
+		duplicatePolicy:     conf.Policy,
+		duplicateSimilarity: conf.Similarity,
+		personStorage:       personStorage,
+		personDataProvider:  personDataProvider,
+		transactor:          transactor,
 	}
 }
 
-func (s *PersonService) Create(ctx context.Context, person *models.Person) (string, error) {
+// Create returns id of created person. Unless duplicate policy is allow, person with the same normalized
+// name is either rejected with ErrPersonDuplicate, or returned with created false and copied into person.
+func (s *PersonService) Create(ctx context.Context, person *models.Person) (_ string, created bool, err error) {
+	ctx, span := tracer.Start(ctx, "PersonService.Create")
+	defer func() { tracing.End(span, err) }()
+
+	checkDuplicates := s.duplicatePolicy != config.DuplicatePolicyAllow
+
+	// duplicates are checked before enrichment, so that they don't spend quotas of enrichment apis
+	if checkDuplicates {
+		duplicate, dupErr := s.getDuplicate(ctx, person)
+		if dupErr != nil {
+			return "", false, dupErr
+		}
+		if duplicate != nil {
+			return s.onDuplicate(person, duplicate)
+		}
+	}
+
 	age, err := s.personDataProvider.GetAge(ctx, person.Name)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	person.Age = age
 
 	gender, err := s.personDataProvider.GetGender(ctx, person.Name)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	person.Gender = gender
 
 	nationality, err := s.personDataProvider.GetNationality(ctx, person.Name)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	person.Nationality = nationality
 
 	person.ID = uuid.NewString()
 	person.CreatedAt = time.Now()
 
-	return s.personStorage.Save(ctx, person)
+	if !checkDuplicates {
+		id, saveErr := s.personStorage.Save(ctx, person)
+		if saveErr != nil {
+			return "", false, saveErr
+		}
+		return id, true, nil
+	}
+
+	// the check is repeated under lock of the name, so that concurrent creates of the same person
+	// can't both pass it. With repeatable_read isolation snapshot is taken before the lock is acquired,
+	// so the check relies on read_committed or serializable
+	var duplicate *models.Person
+	if err = s.transactor.InTx(ctx, func(ctx context.Context) error {
+		if lockErr := s.personStorage.LockName(ctx, person); lockErr != nil {
+			return lockErr
+		}
+
+		var dupErr error
+		if duplicate, dupErr = s.getDuplicate(ctx, person); dupErr != nil || duplicate != nil {
+			return dupErr
+		}
+
+		_, saveErr := s.personStorage.Save(ctx, person)
+		return saveErr
+	}); err != nil {
+		return "", false, err
+	}
+
+	if duplicate != nil {
+		return s.onDuplicate(person, duplicate)
+	}
+
+	return person.ID, true, nil
+}
+
+// getDuplicate returns nil if there is no person with the same normalized name.
+func (s *PersonService) getDuplicate(ctx context.Context, person *models.Person) (*models.Person, error) {
+	duplicate, err := s.personStorage.GetDuplicate(ctx, person)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return duplicate, err
+}
+
+func (s *PersonService) onDuplicate(person, duplicate *models.Person) (string, bool, error) {
+	if s.duplicatePolicy == config.DuplicatePolicyReject {
+		return "", false, fmt.Errorf("%w: %s", ErrPersonDuplicate, duplicate.ID)
+	}
+
+	*person = *duplicate
+	return duplicate.ID, false, nil
 }
 
 func (s *PersonService) Get(ctx context.Context,
-	filters map[string]any, id, createdAt string, limit int) ([]models.Person, error) {
-	return s.personStorage.Get(ctx, filters, id, createdAt, limit)
+	filters map[string]any, id, createdAt string, limit int, order models.Order) (_ []models.Person, err error) {
+	ctx, span := tracer.Start(ctx, "PersonService.Get")
+	defer func() { tracing.End(span, err) }()
+
+	return s.personStorage.Get(ctx, filters, id, createdAt, limit, order)
+}
+
+func (s *PersonService) GetByID(ctx context.Context, id string) (_ *models.Person, err error) {
+	ctx, span := tracer.Start(ctx, "PersonService.GetByID")
+	defer func() { tracing.End(span, err) }()
+
+	person, err := s.personStorage.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPersonNotExist
+		}
+		return nil, err
+	}
+
+	return person, nil
+}
+
+// Update returns updated person. Update is a single statement, so person can't be deleted
+// concurrently between the check that it exists and the update.
+func (s *PersonService) Update(ctx context.Context, id string, fields map[string]any) (_ *models.Person, err error) {
+	ctx, span := tracer.Start(ctx, "PersonService.Update")
+	defer func() { tracing.End(span, err) }()
+
+	person, err := s.personStorage.Update(ctx, id, fields)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPersonNotExist
+		}
+		return nil, err
+	}
+
+	return person, nil
 }
 
-func (s *PersonService) Update(ctx context.Context, id string, fields map[string]any) error {
-	if _, err := s.personStorage.GetByID(ctx, id); err != nil {
-		return ErrPersonNotExist
+// Delete returns deleted person. Like Update, it is a single statement, so it needs no transaction
+// locking the person first.
+func (s *PersonService) Delete(ctx context.Context, id string) (_ *models.Person, err error) {
+	ctx, span := tracer.Start(ctx, "PersonService.Delete")
+	defer func() { tracing.End(span, err) }()
+
+	person, err := s.personStorage.Delete(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPersonNotExist
+		}
+		return nil, err
 	}
 
-	return s.personStorage.Update(ctx, id, fields)
+	return person, nil
 }
 
-func (s *PersonService) Delete(ctx context.Context, id string) error {
-	if _, err := s.personStorage.GetByID(ctx, id); err != nil {
-		return ErrPersonNotExist
+// Duplicates returns clusters of persons linked by pairs with similar names, the most similar first.
+// Clusters are built of at most limit most similar pairs. Zero similarity means the configured one.
+func (s *PersonService) Duplicates(ctx context.Context,
+	similarity float64, limit int) (_ []models.DuplicateCluster, err error) {
+	ctx, span := tracer.Start(ctx, "PersonService.Duplicates")
+	defer func() { tracing.End(span, err) }()
+
+	if similarity == 0 {
+		similarity = s.duplicateSimilarity
+	}
+
+	pairs, err := s.personStorage.GetDuplicatePairs(ctx, similarity, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return []models.DuplicateCluster{}, nil
+	}
+
+	ids := make([]string, 0, 2*len(pairs))
+	seen := make(map[string]bool)
+	for _, pair := range pairs {
+		for _, id := range []string{pair.ID, pair.DuplicateID} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
 	}
 
-	return s.personStorage.Delete(ctx, id)
+	persons, err := s.personStorage.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// persons are grouped with union-find, every cluster is named by its root, persons deleted
+	// after pairs were found are skipped
+	parent := make(map[string]string, len(persons))
+	for _, person := range persons {
+		parent[person.ID] = person.ID
+	}
+	find := func(id string) string {
+		for parent[id] != id {
+			parent[id] = parent[parent[id]]
+			id = parent[id]
+		}
+		return id
+	}
+
+	var linked []models.DuplicatePair
+	for _, pair := range pairs {
+		_, ok := parent[pair.ID]
+		_, dupOK := parent[pair.DuplicateID]
+		if ok && dupOK {
+			parent[find(pair.ID)] = find(pair.DuplicateID)
+			linked = append(linked, pair)
+		}
+	}
+
+	clusters := make(map[string]*models.DuplicateCluster)
+	for _, pair := range linked {
+		root := find(pair.ID)
+		if _, ok := clusters[root]; !ok {
+			clusters[root] = &models.DuplicateCluster{}
+		}
+		clusters[root].Similarity = max(clusters[root].Similarity, pair.Similarity)
+	}
+
+	sortPersons(persons)
+	for _, person := range persons {
+		if cluster, ok := clusters[find(person.ID)]; ok {
+			cluster.Persons = append(cluster.Persons, person)
+		}
+	}
+
+	res := make([]models.DuplicateCluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		res = append(res, *cluster)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Similarity != res[j].Similarity {
+			return res[i].Similarity > res[j].Similarity
+		}
+		return lessPerson(res[i].Persons[0], res[j].Persons[0])
+	})
+
+	return res, nil
+}
+
+// Merge merges sources into target in one transaction and returns merged target. Empty fields of target
+// are filled from sources, the oldest first, then sources are deleted. Snapshots of target and every
+// source taken before merge are saved as audit trail.
+func (s *PersonService) Merge(ctx context.Context, targetID string, sourceIDs []string) (_ *models.Person, err error) {
+	ctx, span := tracer.Start(ctx, "PersonService.Merge")
+	defer func() { tracing.End(span, err) }()
+
+	var mergedBy string
+	if principal := auth.PrincipalFrom(ctx); principal != nil {
+		mergedBy = principal.ID
+	}
+
+	var merged *models.Person
+	if err = s.transactor.InTx(ctx, func(ctx context.Context) error {
+		persons, getErr := s.personStorage.GetByIDsForUpdate(ctx, append([]string{targetID}, sourceIDs...))
+		if getErr != nil {
+			return getErr
+		}
+		if len(persons) != len(sourceIDs)+1 {
+			return ErrPersonNotExist
+		}
+
+		var target models.Person
+		sources := make([]models.Person, 0, len(sourceIDs))
+		for _, person := range persons {
+			if person.ID == targetID {
+				target = person
+			} else {
+				sources = append(sources, person)
+			}
+		}
+		sortPersons(sources)
+
+		merges, auditErr := newMerges(target, sources, mergedBy)
+		if auditErr != nil {
+			return auditErr
+		}
+		if saveErr := s.personStorage.SaveMerges(ctx, merges); saveErr != nil {
+			return saveErr
+		}
+
+		merged = &target
+		if fields := mergeFields(target, sources); len(fields) != 0 {
+			var updateErr error
+			if merged, updateErr = s.personStorage.Update(ctx, targetID, fields); updateErr != nil {
+				return updateErr
+			}
+		}
+
+		for _, source := range sources {
+			if _, deleteErr := s.personStorage.Delete(ctx, source.ID); deleteErr != nil {
+				return deleteErr
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// mergeFields returns fields of target which are empty and are set in any of sources.
+func mergeFields(target models.Person, sources []models.Person) map[string]any {
+	filled := target
+	for _, source := range sources {
+		if filled.Patronymic == "" {
+			filled.Patronymic = source.Patronymic
+		}
+		if filled.Age == 0 {
+			filled.Age = source.Age
+		}
+		if filled.Gender == "" {
+			filled.Gender = source.Gender
+		}
+		if filled.Nationality == "" {
+			filled.Nationality = source.Nationality
+		}
+	}
+
+	fields := make(map[string]any)
+	if filled.Patronymic != target.Patronymic {
+		fields["patronymic"] = filled.Patronymic
+	}
+	if filled.Age != target.Age {
+		fields["age"] = filled.Age
+	}
+	if filled.Gender != target.Gender {
+		fields["gender"] = filled.Gender
+	}
+	if filled.Nationality != target.Nationality {
+		fields["nationality"] = filled.Nationality
+	}
+
+	return fields
+}
+
+func newMerges(target models.Person, sources []models.Person, mergedBy string) ([]models.PersonMerge, error) {
+	targetJSON, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	merges := make([]models.PersonMerge, 0, len(sources))
+	for _, source := range sources {
+		sourceJSON, marshalErr := json.Marshal(source)
+		if marshalErr != nil {
+			return nil, marshalErr
+		}
+
+		merges = append(merges, models.PersonMerge{
+			ID:       uuid.NewString(),
+			TenantID: target.TenantID,
+			TargetID: target.ID,
+			SourceID: source.ID,
+			Target:   targetJSON,
+			Source:   sourceJSON,
+			MergedBy: mergedBy,
+			MergedAt: now,
+		})
+	}
+
+	return merges, nil
+}
+
+// sortPersons sorts persons by (created_at, id), the oldest first.
+func sortPersons(persons []models.Person) {
+	sort.Slice(persons, func(i, j int) bool {
+		return lessPerson(persons[i], persons[j])
+	})
+}
+
+func lessPerson(a, b models.Person) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
 }
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+type APIKeyStorage struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyStorage(db *sqlx.DB) *APIKeyStorage {
+	return &APIKeyStorage{
+		db: db,
+	}
+}
+
+func (s *APIKeyStorage) Save(ctx context.Context, key *models.APIKey) (err error) {
+	ctx, end := startQuery(ctx, "save_api_key")
+	defer end(&err)
+
+	return execContext(ctx, s.db, `INSERT INTO api_keys (id, name, prefix, tenant_id, key_hash, scopes, created_at)
+											VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		key.ID,
+		key.Name,
+		key.Prefix,
+		key.TenantID,
+		key.Hash,
+		key.Scopes,
+		key.CreatedAt)
+}
+
+// GetByHash returns not revoked key with given hash.
+func (s *APIKeyStorage) GetByHash(ctx context.Context, hash string) (_ *models.APIKey, err error) {
+	ctx, end := startQuery(ctx, "get_api_key_by_hash")
+	defer end(&err)
+
+	var key models.APIKey
+
+	if err = s.db.GetContext(ctx, &key, `SELECT * FROM api_keys WHERE key_hash=$1 AND revoked_at IS NULL`,
+		hash); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// List returns keys of tenant of ctx.
+func (s *APIKeyStorage) List(ctx context.Context) (_ []models.APIKey, err error) {
+	ctx, end := startQuery(ctx, "list_api_keys")
+	defer end(&err)
+
+	var keys []models.APIKey
+
+	if err = s.db.SelectContext(ctx, &keys, `SELECT * FROM api_keys WHERE tenant_id=$1 ORDER BY created_at DESC`,
+		tenant.FromContext(ctx)); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Revoke marks key revoked, it returns sql.ErrNoRows if there is no active key with given id in tenant of ctx.
+func (s *APIKeyStorage) Revoke(ctx context.Context, id string) (err error) {
+	ctx, end := startQuery(ctx, "revoke_api_key")
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at=now()
+											WHERE id=$1 AND tenant_id=$2 AND revoked_at IS NULL`,
+		id, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
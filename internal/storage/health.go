@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type HealthStorage struct {
+	db *sqlx.DB
+}
+
+func NewHealthStorage(db *sqlx.DB) *HealthStorage {
+	return &HealthStorage{
+		db: db,
+	}
+}
+
+func (s *HealthStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// PendingMigrations returns number of embedded migrations not applied according to goose_db_version.
+// Table is read directly, as Migrator takes advisory lock, which would make probes wait for running migrations.
+func (s *HealthStorage) PendingMigrations(ctx context.Context) (int, error) {
+	versions, err := migrationVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	var table *string
+	if err = s.db.GetContext(ctx, &table, `SELECT to_regclass('goose_db_version')::text`); err != nil {
+		return 0, err
+	}
+
+	if table == nil {
+		return len(versions), nil
+	}
+
+	// the latest row of a version tells whether it is applied or rolled back
+	var applied []int64
+	if err = s.db.SelectContext(ctx, &applied, `SELECT version_id FROM (
+    										SELECT DISTINCT ON (version_id) version_id, is_applied
+    										FROM goose_db_version ORDER BY version_id, id DESC) v
+											WHERE is_applied`); err != nil {
+		return 0, err
+	}
+
+	appliedSet := make(map[int64]bool, len(applied))
+	for _, v := range applied {
+		appliedSet[v] = true
+	}
+
+	pending := 0
+	for _, v := range versions {
+		if !appliedSet[v] {
+			pending++
+		}
+	}
+
+	return pending, nil
+}
+
+// migrationVersions parses versions from names of embedded migrations, e.g. 20240117154923_effectivemobiledb.sql.
+func migrationVersions() ([]int64, error) {
+	names, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int64, 0, len(names))
+	for _, name := range names {
+		base := strings.TrimPrefix(name, "migrations/")
+		prefix, _, _ := strings.Cut(base, "_")
+
+		version, parseErr := strconv.ParseInt(prefix, 10, 64)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid migration name %q", base)
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// idempotencyLockTimeout is longer than request timeout, so key left in progress by crashed
+	// instance can be reserved again.
+	idempotencyLockTimeout = 2 * time.Minute
+
+	// idempotencyReserveAttempts bounds retries when reserved key is released or deleted
+	// between insert and select.
+	idempotencyReserveAttempts = 3
+)
+
+// IdempotencyStorage keeps Idempotency-Key of requests and responses to them in postgres, so that
+// retries reaching other replicas are replayed too.
+type IdempotencyStorage struct {
+	log *slog.Logger
+	db  *sqlx.DB
+}
+
+func NewIdempotencyStorage(log *slog.Logger, db *sqlx.DB) *IdempotencyStorage {
+	return &IdempotencyStorage{
+		log: log,
+		db:  db,
+	}
+}
+
+// Reserve marks key in progress until ttl expires and returns nil, or returns existing record if key
+// is already reserved. Conflicting inserts wait for each other, so only one of concurrent requests
+// with the same key reserves it.
+func (s *IdempotencyStorage) Reserve(ctx context.Context, key models.IdempotencyKey,
+	fingerprint string, ttl time.Duration) (_ *models.IdempotencyRecord, err error) {
+	ctx, end := startQuery(ctx, "reserve_idempotency_key")
+	defer end(&err)
+
+	for attempt := 1; ; attempt++ {
+		now := time.Now()
+
+		var reserved bool
+		err = s.db.GetContext(ctx, &reserved, `INSERT INTO idempotency_keys
+					(tenant_id, principal_id, key, fingerprint, created_at, expires_at)
+					VALUES ($1,$2,$3,$4,$5,$6)
+					ON CONFLICT (tenant_id, principal_id, key) DO UPDATE
+					SET fingerprint=EXCLUDED.fingerprint, status_code=NULL, response=NULL, response_headers=NULL,
+						created_at=EXCLUDED.created_at, expires_at=EXCLUDED.expires_at
+					WHERE idempotency_keys.expires_at <= $5
+						OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < $7)
+					RETURNING true`,
+			key.TenantID, key.PrincipalID, key.Key, fingerprint, now, now.Add(ttl), now.Add(-idempotencyLockTimeout))
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		var rec struct {
+			models.IdempotencyRecord
+			RawHeaders []byte `db:"response_headers"`
+		}
+		err = s.db.GetContext(ctx, &rec, `SELECT fingerprint, COALESCE(status_code, 0) AS status_code,
+					COALESCE(response, ''::bytea) AS response, COALESCE(response_headers, '{}'::jsonb) AS response_headers
+					FROM idempotency_keys WHERE tenant_id=$1 AND principal_id=$2 AND key=$3`,
+			key.TenantID, key.PrincipalID, key.Key)
+		if err == nil {
+			if err = json.Unmarshal(rec.RawHeaders, &rec.Headers); err != nil {
+				return nil, fmt.Errorf("invalid response headers: %w", err)
+			}
+			return &rec.IdempotencyRecord, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) || attempt == idempotencyReserveAttempts {
+			return nil, err
+		}
+	}
+}
+
+// Complete saves response to request which reserved key.
+func (s *IdempotencyStorage) Complete(ctx context.Context, key models.IdempotencyKey,
+	fingerprint string, status int, headers http.Header, response []byte) (err error) {
+	ctx, end := startQuery(ctx, "complete_idempotency_key")
+	defer end(&err)
+
+	rawHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+
+	return execContext(ctx, s.db, `UPDATE idempotency_keys SET status_code=$1, response=$2, response_headers=$3::jsonb
+					WHERE tenant_id=$4 AND principal_id=$5 AND key=$6 AND fingerprint=$7 AND status_code IS NULL`,
+		status, response, string(rawHeaders), key.TenantID, key.PrincipalID, key.Key, fingerprint)
+}
+
+// Release deletes key reserved by request which failed, so that it can be retried.
+func (s *IdempotencyStorage) Release(ctx context.Context, key models.IdempotencyKey, fingerprint string) (err error) {
+	ctx, end := startQuery(ctx, "release_idempotency_key")
+	defer end(&err)
+
+	return execContext(ctx, s.db, `DELETE FROM idempotency_keys
+					WHERE tenant_id=$1 AND principal_id=$2 AND key=$3 AND fingerprint=$4 AND status_code IS NULL`,
+		key.TenantID, key.PrincipalID, key.Key, fingerprint)
+}
+
+func (s *IdempotencyStorage) DeleteExpired(ctx context.Context, now time.Time) (err error) {
+	ctx, end := startQuery(ctx, "delete_expired_idempotency_keys")
+	defer end(&err)
+
+	return execContext(ctx, s.db, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+}
+
+// Run deletes expired keys every interval until ctx is done.
+func (s *IdempotencyStorage) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.DeleteExpired(ctx, time.Now()); err != nil {
+				s.log.ErrorContext(ctx, "failed to delete expired idempotency keys", "error", err.Error())
+			}
+		}
+	}
+}
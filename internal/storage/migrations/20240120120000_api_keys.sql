@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE api_keys
+(
+    id         uuid PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    prefix     VARCHAR(16)  NOT NULL,
+    key_hash   VARCHAR(64)  NOT NULL UNIQUE,
+    scopes     VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE api_keys;
+-- +goose StatementEnd
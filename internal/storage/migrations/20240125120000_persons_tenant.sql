@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE persons ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+CREATE INDEX persons_tenant_created_at_id_idx ON persons (tenant_id, created_at DESC, id DESC);
+
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+-- policy applies only to roles which don't own the table, service sets app.tenant_id
+-- per transaction when TENANT_RLS_ENABLED is on
+ALTER TABLE persons ENABLE ROW LEVEL SECURITY;
+CREATE POLICY persons_tenant_isolation ON persons
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP POLICY persons_tenant_isolation ON persons;
+ALTER TABLE persons DISABLE ROW LEVEL SECURITY;
+
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+
+DROP INDEX persons_tenant_created_at_id_idx;
+ALTER TABLE persons DROP COLUMN tenant_id;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- status_code is null while request is in progress
+CREATE TABLE idempotency_keys
+(
+    tenant_id    VARCHAR(64)  NOT NULL,
+    principal_id VARCHAR(255) NOT NULL,
+    key          VARCHAR(255) NOT NULL,
+    fingerprint  CHAR(64)     NOT NULL,
+    status_code  INTEGER,
+    response     BYTEA,
+    created_at   TIMESTAMPTZ  NOT NULL,
+    expires_at   TIMESTAMPTZ  NOT NULL,
+    PRIMARY KEY (tenant_id, principal_id, key)
+);
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idempotency_keys;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- spelling differences in case, spaces and ё don't make persons different
+CREATE FUNCTION person_normalized_name(name TEXT, surname TEXT, patronymic TEXT) RETURNS TEXT
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE
+AS $$
+SELECT btrim(regexp_replace(translate(lower(name || ' ' || surname || ' ' || COALESCE(patronymic, '')),
+                                      'ё', 'е'), '\s+', ' ', 'g'))
+$$;
+
+ALTER TABLE persons ADD COLUMN normalized_name TEXT
+    GENERATED ALWAYS AS (person_normalized_name(name, surname, patronymic)) STORED;
+CREATE INDEX persons_tenant_normalized_name_idx ON persons (tenant_id, normalized_name);
+CREATE INDEX persons_normalized_name_trgm_idx ON persons USING gin (normalized_name gin_trgm_ops);
+
+-- target and source are snapshots of persons before merge, source is deleted by merge
+CREATE TABLE person_merges
+(
+    id        uuid PRIMARY KEY,
+    tenant_id VARCHAR(64)  NOT NULL,
+    target_id uuid         NOT NULL,
+    source_id uuid         NOT NULL,
+    target    JSONB        NOT NULL,
+    source    JSONB        NOT NULL,
+    merged_by VARCHAR(255) NOT NULL,
+    merged_at TIMESTAMPTZ  NOT NULL
+);
+CREATE INDEX person_merges_tenant_target_id_idx ON person_merges (tenant_id, target_id);
+CREATE INDEX person_merges_tenant_source_id_idx ON person_merges (tenant_id, source_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE person_merges;
+
+DROP INDEX persons_normalized_name_trgm_idx;
+DROP INDEX persons_tenant_normalized_name_idx;
+ALTER TABLE persons DROP COLUMN normalized_name;
+DROP FUNCTION person_normalized_name(TEXT, TEXT, TEXT);
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- response_headers are replayed with response, they are null for keys completed before the column was added
+ALTER TABLE idempotency_keys ADD COLUMN response_headers JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE idempotency_keys DROP COLUMN response_headers;
+-- +goose StatementEnd
@@ -2,76 +2,124 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
+	"strconv"
 	"strings"
-	"time"
 
+	"github.com/HeadGardener/effective_mobile/internal/config"
 	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
 	"github.com/jmoiron/sqlx"
 )
 
+// tenantQuotaLockSpace and duplicateLockSpace are the first keys of advisory locks serializing creates
+// within a tenant and creates of persons with the same name.
+const (
+	tenantQuotaLockSpace = 1
+	duplicateLockSpace   = 2
+)
+
+var errNothingToUpdate = errors.New("nothing to update")
+
 type PersonStorage struct {
 	db *sqlx.DB
+	// replicas serve reads which may be stale, it is nil if there are no replicas
+	replicas *Replicas
 
-	debugLogger *slog.Logger
+	rlsEnabled bool
+	quotas     tenant.Quotas
+
+	log *slog.Logger
 }
 
-func NewPersonStorage(db *sqlx.DB) *PersonStorage {
+func NewPersonStorage(conf config.TenantConfig, log *slog.Logger, db *sqlx.DB, replicas *Replicas) *PersonStorage {
 	return &PersonStorage{
-		db:          db,
-		debugLogger: slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})),
-	}
-}
-
-func (s *PersonStorage) Save(ctx context.Context, person *models.Person) (string, error) {
-	start := time.Now()
-	if _, err := s.db.ExecContext(ctx, `INSERT INTO persons
-    										(id, name, surname, patronymic, age, gender, nationality, created_at)
-											VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
-		person.ID,
-		person.Name,
-		person.Surname,
-		person.Patronymic,
-		person.Age,
-		person.Gender,
-		person.Nationality,
-		person.CreatedAt); err != nil {
+		db:         db,
+		replicas:   replicas,
+		rlsEnabled: conf.RLSEnabled,
+		quotas: tenant.Quotas{
+			Default:   conf.DefaultQuota,
+			Overrides: conf.Quotas,
+		},
+		log: log,
+	}
+}
+
+// Save stores person in tenant of ctx. If tenant has a quota, creates within the tenant are serialized
+// with advisory lock, so that concurrent creates can't exceed it.
+func (s *PersonStorage) Save(ctx context.Context, person *models.Person) (_ string, err error) {
+	ctx, end := startQuery(ctx, "save_person")
+	defer end(&err)
+
+	person.TenantID = tenant.FromContext(ctx)
+	quota := s.quotas.Limit(person.TenantID)
+
+	if err = s.run(ctx, s.db, quota > 0, func(q sqlx.ExtContext) error {
+		if quota > 0 {
+			if quotaErr := checkQuota(ctx, q, person.TenantID, quota); quotaErr != nil {
+				return quotaErr
+			}
+		}
+
+		return execContext(ctx, q, `INSERT INTO persons
+    										(id, name, surname, patronymic, age, gender, nationality, created_at, tenant_id)
+											VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+			person.ID,
+			person.Name,
+			person.Surname,
+			person.Patronymic,
+			person.Age,
+			person.Gender,
+			person.Nationality,
+			person.CreatedAt,
+			person.TenantID)
+	}); err != nil {
 		return "", err
 	}
 
-	s.debugLogger.Debug("saved person", "time", time.Since(start).String(), "person_id", person.ID)
 	return person.ID, nil
 }
 
-func (s *PersonStorage) GetByID(ctx context.Context, id string) (*models.Person, error) {
-	start := time.Now()
+// GetByID reads person from replica, so it may be a bit stale, unless it is called in transaction.
+func (s *PersonStorage) GetByID(ctx context.Context, id string) (_ *models.Person, err error) {
+	ctx, end := startQuery(ctx, "get_person_by_id")
+	defer end(&err)
+
 	var person models.Person
 
-	if err := s.db.GetContext(ctx, &person, `SELECT * FROM persons WHERE id=$1`, id); err != nil {
+	if err = s.run(ctx, s.reader(), false, func(q sqlx.ExtContext) error {
+		return sqlx.GetContext(ctx, q, &person, `SELECT * FROM persons WHERE id=$1 AND tenant_id=$2`,
+			id, tenant.FromContext(ctx))
+	}); err != nil {
 		return nil, err
 	}
 
-	s.debugLogger.Debug("select person by id", "time", time.Since(start).String(), "person_id", id)
-
 	return &person, nil
 }
 
 func (s *PersonStorage) Get(ctx context.Context,
-	filters map[string]any, id, createdAt string, limit int) ([]models.Person, error) {
-	start := time.Now()
-	argID := 1
-	args := make([]any, 0)
+	filters map[string]any, id, createdAt string, limit int, order models.Order) (_ []models.Person, err error) {
+	ctx, end := startQuery(ctx, "get_persons")
+	defer end(&err)
+
+	argID := 2
+	args := []any{tenant.FromContext(ctx)}
+
+	cmp, direction := "<", "DESC"
+	if order == models.OrderAsc {
+		cmp, direction = ">", "ASC"
+	}
+
+	getValues := []string{"tenant_id=$1"}
 
-	var pagPart string
 	if id != "" && createdAt != "" {
-		pagPart = fmt.Sprintf(`(id, created_at) < ($%d, $%d)`, argID, argID+1)
-		args = append(args, id, createdAt)
+		getValues = append(getValues, fmt.Sprintf(`(created_at, id) %s ($%d, $%d)`, cmp, argID, argID+1))
+		args = append(args, createdAt, id)
 		argID += 2
 	}
 
-	getValues := make([]string, 0)
 	for column, value := range filters {
 		getValues = append(getValues, fmt.Sprintf("%s=$%d", column, argID))
 		args = append(args, value)
@@ -79,75 +127,270 @@ func (s *PersonStorage) Get(ctx context.Context,
 	}
 
 	var query = strings.Builder{}
-	query.WriteString("SELECT * FROM persons ")
+	query.WriteString("SELECT * FROM persons WHERE ")
+	query.WriteString(strings.Join(getValues, " AND "))
+	query.WriteString(fmt.Sprintf(" ORDER BY created_at %[1]s, id %[1]s LIMIT $%[2]d", direction, argID))
+	args = append(args, limit)
+
+	s.log.DebugContext(ctx, "build up query", "query", query.String())
+
+	var persons []models.Person
 
-	if pagPart != "" || len(getValues) != 0 {
-		query.WriteString("WHERE ")
+	if err = s.run(ctx, s.reader(), false, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &persons, query.String(), args...)
+	}); err != nil {
+		return nil, err
 	}
 
-	if pagPart != "" {
-		query.WriteString(pagPart)
+	return persons, nil
+}
+
+// Update returns updated person, or sql.ErrNoRows if there is no such person.
+func (s *PersonStorage) Update(ctx context.Context, id string, fields map[string]any) (_ *models.Person, err error) {
+	ctx, end := startQuery(ctx, "update_person")
+	defer end(&err)
+
+	// SET without columns is a syntax error, callers must reject such updates earlier
+	if len(fields) == 0 {
+		return nil, errNothingToUpdate
 	}
 
-	if pagPart != "" && len(getValues) != 0 {
-		query.WriteString(" AND ")
+	setValues := make([]string, 0)
+	args := make([]any, 0)
+	argID := 1
+	for column, value := range fields {
+		setValues = append(setValues, fmt.Sprintf("%s=$%d", column, argID))
+		args = append(args, value)
+		argID++
 	}
 
-	if len(getValues) != 0 {
-		query.WriteString(strings.Join(getValues, ", "))
+	query := fmt.Sprintf(`UPDATE persons SET %s WHERE id=$%d AND tenant_id=$%d RETURNING *`,
+		strings.Join(setValues, ", "), argID, argID+1)
+	args = append(args, id, tenant.FromContext(ctx))
+
+	s.log.DebugContext(ctx, "build up query", "query", query)
+
+	var person models.Person
+
+	if err = s.run(ctx, s.db, false, func(q sqlx.ExtContext) error {
+		return sqlx.GetContext(ctx, q, &person, query, args...)
+	}); err != nil {
+		return nil, err
 	}
 
-	query.WriteString(fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", argID))
-	args = append(args, limit)
+	return &person, nil
+}
+
+// Delete returns deleted person, or sql.ErrNoRows if there is no such person.
+func (s *PersonStorage) Delete(ctx context.Context, id string) (_ *models.Person, err error) {
+	ctx, end := startQuery(ctx, "delete_person")
+	defer end(&err)
+
+	var person models.Person
 
-	s.debugLogger.Debug("build up query", "query", query.String())
+	if err = s.run(ctx, s.db, false, func(q sqlx.ExtContext) error {
+		return sqlx.GetContext(ctx, q, &person, `DELETE FROM persons WHERE id=$1 AND tenant_id=$2 RETURNING *`,
+			id, tenant.FromContext(ctx))
+	}); err != nil {
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+// GetDuplicate returns the oldest person of tenant with the same normalized name as person, or
+// sql.ErrNoRows if there is none. It reads primary, as it guards creates.
+func (s *PersonStorage) GetDuplicate(ctx context.Context, person *models.Person) (_ *models.Person, err error) {
+	ctx, end := startQuery(ctx, "get_duplicate_person")
+	defer end(&err)
+
+	var duplicate models.Person
+
+	if err = s.run(ctx, s.db, false, func(q sqlx.ExtContext) error {
+		return sqlx.GetContext(ctx, q, &duplicate, `SELECT * FROM persons
+					WHERE tenant_id=$1 AND normalized_name=person_normalized_name($2,$3,$4)
+					ORDER BY created_at, id LIMIT 1`,
+			tenant.FromContext(ctx), person.Name, person.Surname, person.Patronymic)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &duplicate, nil
+}
+
+// LockName serializes creates of persons with the same normalized name within tenant, it must be
+// called in transaction of Transactor, lock is held until it ends.
+func (s *PersonStorage) LockName(ctx context.Context, person *models.Person) (err error) {
+	ctx, end := startQuery(ctx, "lock_person_name")
+	defer end(&err)
+
+	return s.run(ctx, s.db, true, func(q sqlx.ExtContext) error {
+		return execContext(ctx, q, `SELECT pg_advisory_xact_lock($1,
+					hashtext($2::text || ':' || person_normalized_name($3,$4,$5)))`,
+			duplicateLockSpace, tenant.FromContext(ctx), person.Name, person.Surname, person.Patronymic)
+	})
+}
+
+// GetDuplicatePairs returns pairs of persons of tenant with trigram similarity of normalized names at
+// least similarity, the most similar first. Pairs are found with trigram index, which is used only
+// for similarity threshold of pg_trgm, so it is set for the transaction.
+func (s *PersonStorage) GetDuplicatePairs(ctx context.Context,
+	similarity float64, limit int) (_ []models.DuplicatePair, err error) {
+	ctx, end := startQuery(ctx, "get_duplicate_person_pairs")
+	defer end(&err)
+
+	var pairs []models.DuplicatePair
+
+	if err = s.run(ctx, s.reader(), true, func(q sqlx.ExtContext) error {
+		if setErr := execContext(ctx, q, `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`,
+			strconv.FormatFloat(similarity, 'f', -1, 64)); setErr != nil {
+			return setErr
+		}
+
+		return sqlx.SelectContext(ctx, q, &pairs, `SELECT a.id, b.id AS duplicate_id,
+					similarity(a.normalized_name, b.normalized_name) AS similarity
+					FROM persons a JOIN persons b ON b.tenant_id=a.tenant_id AND a.id < b.id
+						AND b.normalized_name % a.normalized_name
+					WHERE a.tenant_id=$1
+					ORDER BY similarity DESC, a.id, b.id LIMIT $2`,
+			tenant.FromContext(ctx), limit)
+	}); err != nil {
+		return nil, err
+	}
+
+	return pairs, nil
+}
+
+// GetByIDs reads persons from replica, missing persons are skipped.
+func (s *PersonStorage) GetByIDs(ctx context.Context, ids []string) (_ []models.Person, err error) {
+	ctx, end := startQuery(ctx, "get_persons_by_ids")
+	defer end(&err)
 
 	var persons []models.Person
 
-	if err := s.db.SelectContext(ctx, &persons, query.String(), args...); err != nil {
+	if err = s.run(ctx, s.reader(), false, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &persons, `SELECT * FROM persons WHERE tenant_id=$1 AND id = ANY($2)`,
+			tenant.FromContext(ctx), ids)
+	}); err != nil {
 		return nil, err
 	}
 
-	s.debugLogger.Debug("select persons with given filters", "time", time.Since(start).String(),
-		"filters", filters)
+	return persons, nil
+}
+
+// GetByIDsForUpdate locks persons until transaction of Transactor ends, missing persons are skipped.
+// Rows are locked in order of id, so that concurrent merges of the same persons can't deadlock.
+func (s *PersonStorage) GetByIDsForUpdate(ctx context.Context, ids []string) (_ []models.Person, err error) {
+	ctx, end := startQuery(ctx, "get_persons_by_ids_for_update")
+	defer end(&err)
+
+	var persons []models.Person
+
+	if err = s.run(ctx, s.db, true, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &persons, `SELECT * FROM persons WHERE tenant_id=$1 AND id = ANY($2)
+					ORDER BY id FOR UPDATE`,
+			tenant.FromContext(ctx), ids)
+	}); err != nil {
+		return nil, err
+	}
 
 	return persons, nil
 }
 
-func (s *PersonStorage) Update(ctx context.Context, id string, fields map[string]any) error {
-	start := time.Now()
-	setValues := make([]string, 0)
-	args := make([]any, 0)
-	argID := 1
-	for column, value := range fields {
-		setValues = append(setValues, fmt.Sprintf("%s=$%d", column, argID))
-		args = append(args, value)
-		argID++
+// SaveMerges stores audit records of merge.
+func (s *PersonStorage) SaveMerges(ctx context.Context, merges []models.PersonMerge) (err error) {
+	ctx, end := startQuery(ctx, "save_person_merges")
+	defer end(&err)
+
+	return s.run(ctx, s.db, true, func(q sqlx.ExtContext) error {
+		for _, merge := range merges {
+			if insertErr := execContext(ctx, q, `INSERT INTO person_merges
+						(id, tenant_id, target_id, source_id, target, source, merged_by, merged_at)
+						VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+				merge.ID,
+				merge.TenantID,
+				merge.TargetID,
+				merge.SourceID,
+				merge.Target,
+				merge.Source,
+				merge.MergedBy,
+				merge.MergedAt); insertErr != nil {
+				return insertErr
+			}
+		}
+
+		return nil
+	})
+}
+
+// reader returns healthy replica, or primary if there is none.
+func (s *PersonStorage) reader() *sqlx.DB {
+	if db := s.replicas.Reader(); db != nil {
+		return db
 	}
 
-	query := fmt.Sprintf(`UPDATE persons SET %s WHERE id=$%d`,
-		strings.Join(setValues, ", "), argID)
-	args = append(args, id)
+	return s.db
+}
 
-	s.debugLogger.Debug("build up query", "query", query)
+// run calls fn in transaction of Transactor if ctx is in one, otherwise right on db, or in its own
+// transaction if it is required by caller or by row level security, which needs tenant of ctx to be
+// set as app.tenant_id for the transaction.
+func (s *PersonStorage) run(ctx context.Context, db *sqlx.DB, needTx bool, fn func(q sqlx.ExtContext) error) error {
+	if tx := txFrom(ctx); tx != nil {
+		if s.rlsEnabled {
+			if err := setTenant(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	}
 
-	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+	if !needTx && !s.rlsEnabled {
+		return fn(db)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if s.rlsEnabled {
+		if err = setTenant(ctx, tx); err != nil {
+			return err
+		}
+	}
 
-	s.debugLogger.Debug("update person by id with given fields", "time", time.Since(start).String(),
-		"person_id", id, "fields", fields)
+	if err = fn(tx); err != nil {
+		return err
+	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (s *PersonStorage) Delete(ctx context.Context, id string) error {
-	start := time.Now()
-	if _, err := s.db.ExecContext(ctx, `DELETE FROM persons WHERE id=$1`, id); err != nil {
+// setTenant sets tenant of ctx as app.tenant_id for the rest of transaction.
+func setTenant(ctx context.Context, tx *sqlx.Tx) error {
+	return execContext(ctx, tx, `SELECT set_config('app.tenant_id', $1, true)`, tenant.FromContext(ctx))
+}
+
+// checkQuota must be called in transaction, advisory lock is held until it ends.
+func checkQuota(ctx context.Context, q sqlx.ExtContext, tenantID string, quota int) error {
+	if err := execContext(ctx, q, `SELECT pg_advisory_xact_lock($1, hashtext($2))`,
+		tenantQuotaLockSpace, tenantID); err != nil {
 		return err
 	}
 
-	s.debugLogger.Debug("delete person", "time", time.Since(start).String(), "person_id", id)
+	var count int
+	if err := sqlx.GetContext(ctx, q, &count, `SELECT count(*) FROM persons WHERE tenant_id=$1`,
+		tenantID); err != nil {
+		return err
+	}
+
+	if count >= quota {
+		return tenant.ErrQuotaExceeded
+	}
 
 	return nil
 }
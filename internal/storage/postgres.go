@@ -1,21 +1,166 @@
 package storage
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
 	"github.com/HeadGardener/effective_mobile/internal/config"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/HeadGardener/effective_mobile/internal/metrics"
+	"github.com/HeadGardener/effective_mobile/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func NewDB(conf config.DBConfig) (*sqlx.DB, error) {
-	db, err := sqlx.Open("pgx", conf.URL)
+const dbName = "effectivemobiledb"
+
+// maxConnectBackoff caps delay between attempts to connect on start.
+const maxConnectBackoff = 5 * time.Second
+
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// DB is sqlx db over either database/sql pool or native pgxpool, storages use it the same way.
+type DB struct {
+	*sqlx.DB
+	pool *pgxpool.Pool
+}
 
+// NewDB opens pool configured by conf and waits until postgres answers, retrying with backoff
+// for ConnectTimeout.
+func NewDB(ctx context.Context, conf config.DBConfig, log *slog.Logger) (*DB, error) {
+	db, err := openDB(ctx, conf, conf.URL)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = db.Ping(); err != nil {
+	if err = connect(ctx, db.DB, conf, log); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if err = metrics.RegisterDB(db.DB.DB, dbName); err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// openDB opens pool to url with settings of conf, connections are established lazily.
+func openDB(ctx context.Context, conf config.DBConfig, url string) (*DB, error) {
+	mode, ok := queryExecModes[conf.StatementCacheMode]
+	if !ok {
+		return nil, fmt.Errorf("unknown statement cache mode %q", conf.StatementCacheMode)
+	}
+
+	db := &DB{}
+
+	if conf.Pool == config.DBPoolPgxpool {
+		poolConf, err := pgxpool.ParseConfig(url)
+		if err != nil {
+			return nil, err
+		}
+		poolConf.ConnConfig.DefaultQueryExecMode = mode
+		poolConf.MaxConns = int32(conf.MaxOpenConns)
+		// pgxpool has no limit of idle connections, it keeps at least MinConns open instead
+		poolConf.MinConns = int32(min(conf.MaxIdleConns, conf.MaxOpenConns))
+		poolConf.MaxConnLifetime = conf.ConnMaxLifetime
+		poolConf.MaxConnIdleTime = conf.ConnMaxIdleTime
+
+		if db.pool, err = pgxpool.NewWithConfig(ctx, poolConf); err != nil {
+			return nil, err
+		}
+		db.DB = sqlx.NewDb(stdlib.OpenDBFromPool(db.pool), "pgx")
+
+		return db, nil
+	}
+
+	connConf, err := pgx.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	connConf.DefaultQueryExecMode = mode
+
+	sqlDB := stdlib.OpenDB(*connConf)
+	sqlDB.SetMaxOpenConns(conf.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(conf.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(conf.ConnMaxIdleTime)
+	db.DB = sqlx.NewDb(sqlDB, "pgx")
+
+	return db, nil
+}
+
+// connect pings db until it answers, so that service can be started together with postgres.
+func connect(ctx context.Context, db *sqlx.DB, conf config.DBConfig, log *slog.Logger) error {
+	if conf.ConnectTimeout == 0 {
+		return db.PingContext(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, conf.ConnectTimeout)
+	defer cancel()
+
+	backoff := conf.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to connect in %d attempts: %w", attempt, err)
+		}
+
+		log.WarnContext(ctx, "db isn't ready, retrying", "attempt", attempt, "backoff", backoff.String(),
+			"error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to connect in %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
+
+// Close closes db and native pool under it.
+func (db *DB) Close() error {
+	err := db.DB.Close()
+	if db.pool != nil {
+		db.pool.Close()
+	}
+
+	return err
+}
+
+var tracer = tracing.Tracer("internal/storage")
+
+// startQuery starts span of query, returned function is deferred by storage methods with named error result,
+// so that every return is traced and measured.
+func startQuery(ctx context.Context, query string) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, query, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(query)))
+
+	return ctx, func(err *error) {
+		metrics.ObserveDBQuery(query, start, *err)
+		tracing.End(span, *err)
+	}
+}
+
+func execContext(ctx context.Context, q sqlx.ExecerContext, query string, args ...any) error {
+	_, err := q.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/ratelimit"
+	"github.com/jmoiron/sqlx"
+)
+
+// RateLimitStorage keeps rate limit buckets in postgres, so that limits are shared by replicas.
+type RateLimitStorage struct {
+	db *sqlx.DB
+}
+
+func NewRateLimitStorage(db *sqlx.DB) *RateLimitStorage {
+	return &RateLimitStorage{
+		db: db,
+	}
+}
+
+// Take locks bucket row for the transaction, so that concurrent requests of a client are counted one by one.
+func (s *RateLimitStorage) Take(ctx context.Context,
+	key string, limit ratelimit.Limit, now time.Time) (_ ratelimit.Result, err error) {
+	ctx, end := startQuery(ctx, "take_rate_limit_token")
+	defer end(&err)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.ExecContext(ctx, `INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+											VALUES ($1, $2, $3) ON CONFLICT (key) DO NOTHING`,
+		key, float64(limit.Burst), now); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	var bucket ratelimit.Bucket
+	if err = tx.QueryRowxContext(ctx, `SELECT tokens, updated_at FROM rate_limit_buckets WHERE key=$1 FOR UPDATE`,
+		key).Scan(&bucket.Tokens, &bucket.UpdatedAt); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	bucket, res := bucket.Take(limit, now)
+
+	if _, err = tx.ExecContext(ctx, `UPDATE rate_limit_buckets SET tokens=$1, updated_at=$2 WHERE key=$3`,
+		bucket.Tokens, bucket.UpdatedAt, key); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return res, nil
+}
+
+func (s *RateLimitStorage) DeleteIdle(ctx context.Context, before time.Time) (err error) {
+	ctx, end := startQuery(ctx, "delete_idle_rate_limit_buckets")
+	defer end(&err)
+
+	return execContext(ctx, s.db, `DELETE FROM rate_limit_buckets WHERE updated_at < $1`, before)
+}
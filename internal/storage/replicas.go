@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+const replicaCheckTimeout = 2 * time.Second
+
+var (
+	errNoWALReceiver           = errors.New("wal receiver isn't running")
+	errWALReceiverHidden       = errors.New("wal receiver status is hidden, replica user needs pg_monitor role")
+	errWALReceiverNotStreaming = errors.New("wal receiver isn't streaming")
+)
+
+// Replicas routes reads to read replicas lagging behind primary less than ReplicaMaxLag,
+// replicas are checked by Run and are out of rotation until the first check passes.
+type Replicas struct {
+	log      *slog.Logger
+	maxLag   time.Duration
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+type replica struct {
+	name    string
+	db      *DB
+	healthy atomic.Bool
+	// checked is set after the first check, it is accessed only by Run
+	checked bool
+}
+
+// NewReplicas opens pools to ReplicaURLs without waiting for replicas, so that unavailable replica
+// doesn't prevent service from starting.
+func NewReplicas(ctx context.Context, conf config.DBConfig, log *slog.Logger) (*Replicas, error) {
+	r := &Replicas{
+		log:    log,
+		maxLag: conf.ReplicaMaxLag,
+	}
+
+	for _, url := range strings.Split(conf.ReplicaURLs, ",") {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+
+		connConf, err := pgx.ParseConfig(url)
+		if err != nil {
+			_ = r.Close()
+			return nil, fmt.Errorf("invalid replica url: %w", err)
+		}
+		name := fmt.Sprintf("%s:%d", connConf.Host, connConf.Port)
+
+		db, err := openDB(ctx, conf, url)
+		if err != nil {
+			_ = r.Close()
+			return nil, fmt.Errorf("failed to open replica %s: %w", name, err)
+		}
+		r.replicas = append(r.replicas, &replica{name: name, db: db})
+
+		if err = metrics.RegisterDB(db.DB.DB, dbName+"_replica_"+name); err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Reader returns healthy replica in round robin, or nil if there is none.
+func (r *Replicas) Reader() *sqlx.DB {
+	if r == nil || len(r.replicas) == 0 {
+		return nil
+	}
+
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if rep.healthy.Load() {
+			return rep.db.DB
+		}
+	}
+
+	return nil
+}
+
+// Run checks replication lag of replicas every interval until ctx is done.
+func (r *Replicas) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Replicas) check(ctx context.Context) {
+	for _, rep := range r.replicas {
+		lag, err := replicationLag(ctx, rep.db.DB)
+		if err != nil {
+			metrics.SetDBReplicaLag(rep.name, -time.Second)
+		} else {
+			metrics.SetDBReplicaLag(rep.name, lag)
+		}
+
+		healthy := err == nil && lag <= r.maxLag
+		if rep.healthy.Swap(healthy) == healthy && rep.checked {
+			continue
+		}
+		rep.checked = true
+
+		switch {
+		case healthy:
+			r.log.InfoContext(ctx, "replica put into rotation", "replica", rep.name, "lag", lag.String())
+		case err != nil:
+			r.log.WarnContext(ctx, "replica removed from rotation", "replica", rep.name, "error", err.Error())
+		default:
+			r.log.WarnContext(ctx, "replica removed from rotation", "replica", rep.name, "lag", lag.String())
+		}
+	}
+}
+
+// replicationLag is time since the last replayed transaction, or zero if replica has replayed
+// everything it received, as then there is nothing to catch up with on idle primary. Replica which
+// doesn't stream wal from primary stops receiving anything, so it is reported with error.
+func replicationLag(ctx context.Context, db *sqlx.DB) (lag time.Duration, err error) {
+	ctx, end := startQuery(ctx, "get_replication_lag")
+	defer end(&err)
+
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	var status sql.NullString
+	err = db.GetContext(ctx, &status, `SELECT status FROM pg_stat_wal_receiver`)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, errNoWALReceiver
+	case err != nil:
+		return 0, err
+	case !status.Valid:
+		return 0, errWALReceiverHidden
+	case status.String != "streaming":
+		return 0, fmt.Errorf("%w: %s", errWALReceiverNotStreaming, status.String)
+	}
+
+	var seconds float64
+	if err = db.GetContext(ctx, &seconds, `SELECT COALESCE(CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+	END, 0)::float8`); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (r *Replicas) Close() error {
+	var errs []error
+	for _, rep := range r.replicas {
+		errs = append(errs, rep.db.Close())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+
+	// txRetryBackoff is delay before the first retry, it doubles after every retry.
+	txRetryBackoff = 10 * time.Millisecond
+)
+
+var txIsolationLevels = map[string]sql.IsolationLevel{
+	config.TxIsolationReadCommitted:  sql.LevelReadCommitted,
+	config.TxIsolationRepeatableRead: sql.LevelRepeatableRead,
+	config.TxIsolationSerializable:   sql.LevelSerializable,
+}
+
+type txKey struct{}
+
+// Transactor runs units of work spanning several storage calls in a transaction on primary.
+type Transactor struct {
+	db         *sqlx.DB
+	isolation  sql.IsolationLevel
+	maxRetries int
+
+	log *slog.Logger
+}
+
+func NewTransactor(conf config.DBConfig, log *slog.Logger, db *sqlx.DB) *Transactor {
+	return &Transactor{
+		db:         db,
+		isolation:  txIsolationLevels[conf.TxIsolation],
+		maxRetries: conf.TxMaxRetries,
+		log:        log,
+	}
+}
+
+// InTx runs fn in transaction, storages called with ctx passed to fn take part in it. Transaction is
+// committed if fn returns nil, and the whole fn is retried on serialization failures and deadlocks,
+// so fn must have no side effects besides storage calls. Nested calls join outer transaction.
+func (t *Transactor) InTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if txFrom(ctx) != nil {
+		return fn(ctx)
+	}
+
+	ctx, end := startQuery(ctx, "transaction")
+	defer end(&err)
+
+	for attempt := 1; ; attempt++ {
+		err = t.runTx(ctx, fn)
+		if err == nil || !isRetryable(err) || attempt > t.maxRetries {
+			return err
+		}
+
+		delay := txRetryBackoff<<(attempt-1) + time.Duration(rand.Int63n(int64(txRetryBackoff)))
+		t.log.WarnContext(ctx, "retrying transaction", "attempt", attempt, "delay", delay.String(),
+			"error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (t *Transactor) runTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := t.db.BeginTxx(ctx, &sql.TxOptions{Isolation: t.isolation})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// txFrom returns transaction started by Transactor, or nil if ctx isn't in one.
+func txFrom(ctx context.Context) *sqlx.Tx {
+	tx, _ := ctx.Value(txKey{}).(*sqlx.Tx)
+	return tx
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == serializationFailureCode || pgErr.Code == deadlockDetectedCode
+}
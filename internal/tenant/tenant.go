@@ -0,0 +1,85 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Default is tenant of anonymous requests and of persons created before multi-tenancy.
+const Default = "default"
+
+var (
+	ErrQuotaExceeded = errors.New("tenant persons quota exceeded")
+	ErrInvalidID     = errors.New("invalid tenant id, it must contain 1-64 lowercase letters, digits, '-' or '_'")
+
+	idRegexp = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+)
+
+type ctxKey struct{}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns tenant of the request, Default if it is not set.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(ctxKey{}).(string); ok && id != "" {
+		return id
+	}
+
+	return Default
+}
+
+func ValidateID(id string) error {
+	if !idRegexp.MatchString(id) {
+		return ErrInvalidID
+	}
+
+	return nil
+}
+
+// Quotas are limits on number of persons per tenant, zero means unlimited.
+type Quotas struct {
+	Default   int
+	Overrides map[string]int
+}
+
+func (q Quotas) Limit(id string) int {
+	if limit, ok := q.Overrides[id]; ok {
+		return limit
+	}
+
+	return q.Default
+}
+
+// ParseQuotas parses overrides in "tenant_a=100,tenant_b=500" format.
+func ParseQuotas(s string) (map[string]int, error) {
+	overrides := make(map[string]int)
+	if s == "" {
+		return overrides, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		id, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid quota %q, it must be in tenant=limit format", pair)
+		}
+
+		if err := ValidateID(id); err != nil {
+			return nil, fmt.Errorf("invalid quota %q: %w", pair, err)
+		}
+
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid quota %q, limit must be a non-negative integer", pair)
+		}
+
+		overrides[id] = limit
+	}
+
+	return overrides, nil
+}
@@ -0,0 +1,157 @@
+package tracing_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/HeadGardener/effective_mobile/internal/client"
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/handlers"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/services"
+	"github.com/HeadGardener/effective_mobile/internal/tracing"
+)
+
+const (
+	traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	remoteSpanID = "00f067aa0ba902b7"
+)
+
+type personStorage struct {
+	services.PersonStorage
+}
+
+func (personStorage) Save(_ context.Context, person *models.Person) (string, error) {
+	return person.ID, nil
+}
+
+// upstream serves every enrichment api and remembers traceparent of requests by path.
+type upstream struct {
+	mu          sync.Mutex
+	traceparent map[string]string
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	u.traceparent[r.URL.Path] = r.Header.Get("traceparent")
+	u.mu.Unlock()
+
+	_, _ = io.WriteString(w, `{"age": 30, "gender": "male", "country": [{"country_id": "RU"}]}`)
+}
+
+var (
+	exporter = tracetest.NewInMemoryExporter()
+	provider = tracing.NewProvider(config.TracingConfig{ServiceName: "test", SampleRatio: 1}, exporter)
+)
+
+// TestMain sets global provider once, as package tracers keep delegating to the first one set.
+func TestMain(m *testing.M) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	os.Exit(m.Run())
+}
+
+func TestCreatePersonSpanTree(t *testing.T) {
+	exporter.Reset()
+
+	up := &upstream{traceparent: make(map[string]string)}
+	upstreamSrv := httptest.NewServer(up)
+	t.Cleanup(upstreamSrv.Close)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cl := client.NewClient(config.HTTPClientConfig{
+		AgeBaseURL:         upstreamSrv.URL + "/age",
+		GenderBaseURL:      upstreamSrv.URL + "/gender",
+		NationalityBaseURL: upstreamSrv.URL + "/nationality",
+		QuotaMode:          config.QuotaModeQueue,
+	}, log)
+	personService := services.NewPersonService(config.DuplicatesConfig{Policy: config.DuplicatePolicyAllow},
+		personStorage{}, cl, nil)
+	h := handlers.NewHandler(config.HandlerConfig{MaxBodyBytes: 1 << 20}, log, personService,
+		nil, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/", strings.NewReader(`{"name": "Ivan", "surname": "Ivanov"}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-"+remoteSpanID+"-01")
+	w := httptest.NewRecorder()
+	h.InitRoutes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("failed to flush spans: %s", err)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("span %q doesn't continue incoming trace", span.Name)
+		}
+		spans[span.Name] = span
+	}
+
+	server := requireSpan(t, spans, "POST /api")
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("expected server span, got %s", server.SpanKind)
+	}
+	if server.Parent.SpanID().String() != remoteSpanID || !server.Parent.IsRemote() {
+		t.Errorf("server span isn't child of remote span from traceparent, parent %s", server.Parent.SpanID())
+	}
+
+	service := requireSpan(t, spans, "PersonService.Create")
+	requireParent(t, service, server)
+
+	for name, path := range map[string]string{
+		"GET agify":       "/age",
+		"GET genderize":   "/gender",
+		"GET nationalize": "/nationality",
+	} {
+		span := requireSpan(t, spans, name)
+		requireParent(t, span, service)
+		if span.SpanKind != trace.SpanKindClient {
+			t.Errorf("expected %q to be client span, got %s", name, span.SpanKind)
+		}
+
+		want := "00-" + traceID + "-" + span.SpanContext.SpanID().String() + "-01"
+		if got := up.traceparent[path]; got != want {
+			t.Errorf("expected %s to get traceparent %q, got %q", path, want, got)
+		}
+	}
+}
+
+func requireSpan(t *testing.T, spans map[string]tracetest.SpanStub, name string) tracetest.SpanStub {
+	t.Helper()
+
+	span, ok := spans[name]
+	if !ok {
+		names := make([]string, 0, len(spans))
+		for n := range spans {
+			names = append(names, n)
+		}
+		t.Fatalf("span %q isn't recorded, recorded spans are %v", name, names)
+	}
+
+	return span
+}
+
+func requireParent(t *testing.T, span, parent tracetest.SpanStub) {
+	t.Helper()
+
+	if span.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("expected %q to be child of %q", span.Name, parent.Name)
+	}
+}
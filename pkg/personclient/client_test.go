@@ -0,0 +1,431 @@
+package personclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/HeadGardener/effective_mobile/internal/auth"
+	"github.com/HeadGardener/effective_mobile/internal/config"
+	"github.com/HeadGardener/effective_mobile/internal/handlers"
+	"github.com/HeadGardener/effective_mobile/internal/models"
+	"github.com/HeadGardener/effective_mobile/internal/services"
+	"github.com/HeadGardener/effective_mobile/internal/tenant"
+	"github.com/HeadGardener/effective_mobile/pkg/personclient"
+)
+
+const (
+	writerKey = "writer"
+	readerKey = "reader"
+
+	cursorLayout = "2006-01-02 15:04:05.000000"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// personService keeps persons in memory, every next person is created a second later than previous one.
+type personService struct {
+	handlers.PersonService
+
+	mu             sync.Mutex
+	persons        []models.Person
+	failCreate     bool
+	returnExisting bool
+	creates        atomic.Int32
+	gets           atomic.Int32
+}
+
+func (s *personService) Create(_ context.Context, person *models.Person) (string, bool, error) {
+	s.creates.Add(1)
+	if s.failCreate {
+		return "", false, errors.New("unexpected error")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.persons {
+		if p.Name != person.Name || p.Surname != person.Surname {
+			continue
+		}
+		if s.returnExisting {
+			*person = p
+			return p.ID, false, nil
+		}
+		return "", false, services.ErrPersonDuplicate
+	}
+
+	person.ID = uuid.NewString()
+	person.CreatedAt = start.Add(time.Duration(len(s.persons)) * time.Second)
+	s.persons = append(s.persons, *person)
+
+	return person.ID, true, nil
+}
+
+func (s *personService) Get(_ context.Context, filters map[string]any, id, createdAt string, limit int,
+	_ models.Order) ([]models.Person, error) {
+	s.gets.Add(1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var after time.Time
+	if id != "" {
+		var err error
+		if after, err = time.Parse(cursorLayout, createdAt); err != nil {
+			return nil, err
+		}
+	}
+
+	persons := make([]models.Person, 0, limit)
+	for i := len(s.persons) - 1; i >= 0; i-- {
+		p := s.persons[i]
+		if name, ok := filters["name"]; ok && p.Name != name {
+			continue
+		}
+		if id != "" && !p.CreatedAt.Before(after) {
+			continue
+		}
+		if len(persons) == limit {
+			break
+		}
+		persons = append(persons, p)
+	}
+
+	return persons, nil
+}
+
+func (s *personService) GetByID(_ context.Context, id string) (*models.Person, error) {
+	s.gets.Add(1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i == -1 {
+		return nil, services.ErrPersonNotExist
+	}
+
+	person := s.persons[i]
+	return &person, nil
+}
+
+func (s *personService) Update(_ context.Context, id string, fields map[string]any) (*models.Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i == -1 {
+		return nil, services.ErrPersonNotExist
+	}
+
+	if age, ok := fields["age"].(int8); ok {
+		s.persons[i].Age = age
+	}
+	if nationality, ok := fields["nationality"].(string); ok {
+		s.persons[i].Nationality = nationality
+	}
+
+	person := s.persons[i]
+	return &person, nil
+}
+
+func (s *personService) Delete(_ context.Context, id string) (*models.Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i == -1 {
+		return nil, services.ErrPersonNotExist
+	}
+
+	person := s.persons[i]
+	s.persons = slices.Delete(s.persons, i, i+1)
+	return &person, nil
+}
+
+func (s *personService) index(id string) int {
+	return slices.IndexFunc(s.persons, func(p models.Person) bool { return p.ID == id })
+}
+
+// authenticator lets writer key to do anything with persons, and reader key only to read them.
+type authenticator struct{}
+
+func (authenticator) Authenticate(_ context.Context, token string) (*auth.Principal, error) {
+	switch token {
+	case writerKey:
+		return &auth.Principal{ID: token, TenantID: tenant.Default,
+			Scopes: []auth.Scope{auth.ScopePersonsRead, auth.ScopePersonsWrite, auth.ScopePersonsDelete}}, nil
+	case readerKey:
+		return &auth.Principal{ID: token, TenantID: tenant.Default, Scopes: []auth.Scope{auth.ScopePersonsRead}}, nil
+	default:
+		return nil, auth.ErrInvalidToken
+	}
+}
+
+// unavailable answers first n requests with 503 before passing requests to next.
+func unavailable(n int32, next http.Handler) (http.Handler, *atomic.Int32) {
+	var calls atomic.Int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= n {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = io.WriteString(w, `{"Msg": "overloaded", "Error": "try later"}`)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}), &calls
+}
+
+func newRoutes(personService *personService) http.Handler {
+	h := handlers.NewHandler(config.HandlerConfig{MaxBodyBytes: 1 << 20, AuthEnabled: true},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), personService, nil, authenticator{}, nil, nil, nil, nil)
+
+	return h.InitRoutes()
+}
+
+func newClient(t *testing.T, handler http.Handler, key string) *personclient.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := personclient.New(srv.URL, personclient.WithRetries(2, time.Millisecond, time.Millisecond),
+		personclient.WithAPIKey(key))
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+
+	return c
+}
+
+func create(t *testing.T, c *personclient.Client, name, surname string) string {
+	t.Helper()
+
+	id, err := c.Create(context.Background(), personclient.CreateRequest{Name: name, Surname: surname})
+	if err != nil {
+		t.Fatalf("failed to create person: %s", err)
+	}
+
+	return id
+}
+
+func TestNewRejectsRelativeURL(t *testing.T) {
+	if _, err := personclient.New("localhost:8080"); err == nil {
+		t.Fatal("expected url without scheme to be rejected")
+	}
+}
+
+func TestPersonLifecycle(t *testing.T) {
+	c := newClient(t, newRoutes(&personService{}), writerKey)
+	ctx := context.Background()
+
+	id := create(t, c, "Ivan", "Ivanov")
+
+	person, err := c.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get person: %s", err)
+	}
+	if person.ID != id || person.Name != "Ivan" || person.Surname != "Ivanov" || !person.CreatedAt.Equal(start) {
+		t.Fatalf("unexpected person %+v", person)
+	}
+
+	age, nationality := int8(30), "RU"
+	person, err = c.Update(ctx, id, personclient.UpdateRequest{Age: &age, Nationality: &nationality})
+	if err != nil {
+		t.Fatalf("failed to update person: %s", err)
+	}
+	if person.Age != age || person.Nationality != nationality {
+		t.Fatalf("person isn't updated %+v", person)
+	}
+
+	if person, err = c.Delete(ctx, id); err != nil {
+		t.Fatalf("failed to delete person: %s", err)
+	}
+	if person.ID != id {
+		t.Fatalf("unexpected deleted person %+v", person)
+	}
+
+	if _, err = c.Get(ctx, id); !errors.Is(err, personclient.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for deleted person, got %v", err)
+	}
+}
+
+func TestCreateReturnsExistingPerson(t *testing.T) {
+	routes := newRoutes(&personService{returnExisting: true})
+	c := newClient(t, routes, writerKey)
+
+	id := create(t, c, "Ivan", "Ivanov")
+	if existing := create(t, c, "Ivan", "Ivanov"); existing != id {
+		t.Fatalf("expected id of existing person %q, got %q", id, existing)
+	}
+
+	// existing person is answered in full
+	req := httptest.NewRequest(http.MethodPost, "/api/", strings.NewReader(`{"name": "Ivan", "surname": "Ivanov"}`))
+	req.Header.Set("Authorization", "Bearer "+writerKey)
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, req)
+
+	var person personclient.Person
+	if err := json.NewDecoder(w.Body).Decode(&person); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if w.Code != http.StatusOK || person.ID != id || person.Surname != "Ivanov" || !person.CreatedAt.Equal(start) {
+		t.Fatalf("expected existing person with status %d, got %d and %+v", http.StatusOK, w.Code, person)
+	}
+}
+
+func TestCreateIsNotRetried(t *testing.T) {
+	personService := &personService{failCreate: true}
+	c := newClient(t, newRoutes(personService), writerKey)
+
+	_, err := c.Create(context.Background(), personclient.CreateRequest{Name: "Ivan", Surname: "Ivanov"})
+	if !errors.Is(err, personclient.ErrInternal) {
+		t.Fatalf("expected ErrInternal, got %v", err)
+	}
+	if creates := personService.creates.Load(); creates != 1 {
+		t.Fatalf("expected a single create, got %d", creates)
+	}
+}
+
+func TestGetRetriesServerErrors(t *testing.T) {
+	personService := &personService{}
+	handler, calls := unavailable(2, newRoutes(personService))
+	c := newClient(t, handler, writerKey)
+
+	// create isn't retried, so it's sent after server is back
+	calls.Store(2)
+	id := create(t, c, "Ivan", "Ivanov")
+	calls.Store(0)
+
+	person, err := c.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to get person: %s", err)
+	}
+	if person.ID != id || person.Name != "Ivan" {
+		t.Fatalf("unexpected person %+v", person)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 requests, got %d", calls.Load())
+	}
+}
+
+func TestErrorsMatchSentinels(t *testing.T) {
+	routes := newRoutes(&personService{})
+	writer := newClient(t, routes, writerKey)
+	reader := newClient(t, routes, readerKey)
+	stranger := newClient(t, routes, "unknown")
+
+	id := create(t, writer, "Ivan", "Ivanov")
+
+	tests := []struct {
+		name string
+		code int
+		want error
+		call func(context.Context) error
+	}{
+		{
+			name: "invalid name", code: http.StatusBadRequest, want: personclient.ErrBadRequest,
+			call: func(ctx context.Context) error {
+				_, err := writer.Create(ctx, personclient.CreateRequest{Name: "Ivan1", Surname: "Ivanov"})
+				return err
+			},
+		},
+		{
+			name: "invalid id", code: http.StatusBadRequest, want: personclient.ErrBadRequest,
+			call: func(ctx context.Context) error {
+				_, err := writer.Delete(ctx, "person-id")
+				return err
+			},
+		},
+		{
+			name: "unknown key", code: http.StatusUnauthorized, want: personclient.ErrUnauthorized,
+			call: func(ctx context.Context) error {
+				_, err := stranger.Get(ctx, id)
+				return err
+			},
+		},
+		{
+			name: "missing scope", code: http.StatusForbidden, want: personclient.ErrForbidden,
+			call: func(ctx context.Context) error {
+				_, err := reader.Delete(ctx, id)
+				return err
+			},
+		},
+		{
+			name: "missing person", code: http.StatusNotFound, want: personclient.ErrNotFound,
+			call: func(ctx context.Context) error {
+				_, err := writer.Delete(ctx, uuid.NewString())
+				return err
+			},
+		},
+		{
+			name: "duplicate", code: http.StatusConflict, want: personclient.ErrConflict,
+			call: func(ctx context.Context) error {
+				_, err := writer.Create(ctx, personclient.CreateRequest{Name: "Ivan", Surname: "Ivanov"})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		err := tt.call(context.Background())
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+			continue
+		}
+
+		var apiErr *personclient.Error
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: expected *Error, got %T", tt.name, err)
+			continue
+		}
+		if apiErr.StatusCode != tt.code || apiErr.Msg == "" || apiErr.Reason == "" {
+			t.Errorf("%s: unexpected error %+v", tt.name, apiErr)
+		}
+	}
+}
+
+func TestIteratorWalksPages(t *testing.T) {
+	personService := &personService{}
+	c := newClient(t, newRoutes(personService), writerKey)
+
+	var want []string
+	for _, surname := range []string{"Ivanov", "Petrov", "Sidorov", "Smirnov", "Popov"} {
+		want = append(want, create(t, c, "Ivan", surname))
+		create(t, c, "Petr", surname)
+	}
+	// persons are listed from the newest one
+	slices.Reverse(want)
+
+	personService.gets.Store(0)
+	it := c.List(personclient.NewFilter().Name("Ivan"), 2)
+
+	var ids []string
+	for it.Next(context.Background()) {
+		ids = append(ids, it.Person().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("failed to list persons: %s", err)
+	}
+
+	if !slices.Equal(ids, want) {
+		t.Fatalf("expected persons %v, got %v", want, ids)
+	}
+	// the last page is shorter than page size, so there is no request for an empty page
+	if pages := personService.gets.Load(); pages != 3 {
+		t.Fatalf("expected 3 pages, got %d", pages)
+	}
+}
@@ -0,0 +1,78 @@
+package personclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const maxErrorBodySize = 1 << 16
+
+// Sentinel errors matched by *Error with errors.Is, they mirror status codes returned by the server.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("person not found")
+	ErrConflict     = errors.New("conflict")
+	ErrTooMany      = errors.New("too many requests")
+	ErrInternal     = errors.New("internal server error")
+	ErrUnavailable  = errors.New("service unavailable")
+)
+
+// Error is returned for every response with status code >= 400.
+type Error struct {
+	StatusCode int
+	// Msg describes failed operation, Reason describes the cause, both are taken from server response.
+	Msg    string
+	Reason string
+}
+
+func newError(resp *http.Response) *Error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+
+	var body struct {
+		Msg   string `json:"Msg"`
+		Error string `json:"Error"`
+	}
+
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err := json.Unmarshal(raw, &body); err == nil {
+		apiErr.Msg, apiErr.Reason = body.Msg, body.Error
+	} else {
+		apiErr.Reason = string(raw)
+	}
+
+	return apiErr
+}
+
+func (e *Error) Error() string {
+	if e.Msg == "" && e.Reason == "" {
+		return fmt.Sprintf("person api: status %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("person api: status %d: %s: %s", e.StatusCode, e.Msg, e.Reason)
+}
+
+func (e *Error) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return target == ErrBadRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusTooManyRequests:
+		return target == ErrTooMany
+	case http.StatusServiceUnavailable:
+		return target == ErrUnavailable
+	}
+
+	return e.StatusCode >= http.StatusInternalServerError && target == ErrInternal
+}
@@ -0,0 +1,56 @@
+package personclient
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Filter is a builder of persons filters, all set filters must match.
+//
+//	f := personclient.NewFilter().Name("Ivan").Age(30)
+type Filter struct {
+	query url.Values
+}
+
+func NewFilter() *Filter {
+	return &Filter{query: make(url.Values)}
+}
+
+func (f *Filter) Name(name string) *Filter {
+	f.query.Set("name", name)
+	return f
+}
+
+func (f *Filter) Surname(surname string) *Filter {
+	f.query.Set("surname", surname)
+	return f
+}
+
+func (f *Filter) Age(age int) *Filter {
+	f.query.Set("age", strconv.Itoa(age))
+	return f
+}
+
+func (f *Filter) Gender(gender string) *Filter {
+	f.query.Set("gender", gender)
+	return f
+}
+
+func (f *Filter) Nationality(nationality string) *Filter {
+	f.query.Set("nationality", nationality)
+	return f
+}
+
+// values returns a copy of filters, nil Filter matches every person.
+func (f *Filter) values() url.Values {
+	query := make(url.Values)
+	if f == nil {
+		return query
+	}
+
+	for key, values := range f.query {
+		query[key] = append([]string(nil), values...)
+	}
+
+	return query
+}
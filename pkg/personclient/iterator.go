@@ -0,0 +1,104 @@
+package personclient
+
+import (
+	"context"
+	"net/url"
+)
+
+const (
+	cursorLayout            = "2006-01-02 15:04:05.000000"
+	defaultIteratorPageSize = 100
+)
+
+// Cursor points to the last seen person, persons are listed from the newest to the oldest.
+type Cursor struct {
+	PersonID  string
+	CreatedAt string
+}
+
+func cursorOf(person *Person) Cursor {
+	return Cursor{
+		PersonID:  person.ID,
+		CreatedAt: person.CreatedAt.UTC().Format(cursorLayout),
+	}
+}
+
+// IsZero reports whether cursor points to the beginning of the list.
+func (c Cursor) IsZero() bool {
+	return c.PersonID == "" || c.CreatedAt == ""
+}
+
+func (c Cursor) apply(query url.Values) {
+	if c.IsZero() {
+		return
+	}
+
+	query.Set("person_id", c.PersonID)
+	query.Set("created_at", c.CreatedAt)
+}
+
+// Iterator lazily fetches pages of persons.
+//
+//	it := client.List(filter, 100)
+//	for it.Next(ctx) {
+//		p := it.Person()
+//	}
+//	if err := it.Err(); err != nil {...}
+type Iterator struct {
+	client   *Client
+	filter   *Filter
+	pageSize int
+
+	page   []Person
+	pos    int
+	cursor Cursor
+	done   bool
+	err    error
+}
+
+// Next advances iterator to the next person, fetching the next page if needed.
+// It returns false when there are no more persons or an error happened.
+func (it *Iterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	if it.pos+1 < len(it.page) {
+		it.pos++
+		return true
+	}
+
+	if it.done {
+		return false
+	}
+
+	pageSize := it.pageSize
+	if pageSize <= 0 {
+		pageSize = defaultIteratorPageSize
+	}
+
+	page, next, err := it.client.ListPage(ctx, it.filter, it.cursor, pageSize)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.page, it.pos, it.cursor = page, 0, next
+	it.done = next.IsZero()
+
+	return len(it.page) != 0
+}
+
+// Person returns the current person, valid only after Next returned true.
+func (it *Iterator) Person() Person {
+	return it.page[it.pos]
+}
+
+// Cursor returns cursor of the next page, it can be stored to resume listing with ListPage later.
+func (it *Iterator) Cursor() Cursor {
+	return it.cursor
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,178 @@
+package personclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	personsPath    = "/api/"
+	duplicatesPath = "/api/duplicates"
+	mergePath      = "/api/merge"
+)
+
+// Person is a person as it is returned by the server.
+type Person struct {
+	ID          string    `json:"ID"`
+	Name        string    `json:"Name"`
+	Surname     string    `json:"Surname"`
+	Patronymic  string    `json:"Patronymic"`
+	Age         int8      `json:"Age"`
+	Gender      string    `json:"Gender"`
+	Nationality string    `json:"Nationality"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+}
+
+type CreateRequest struct {
+	Name       string `json:"name"`
+	Surname    string `json:"surname"`
+	Patronymic string `json:"patronymic,omitempty"`
+}
+
+// UpdateRequest holds fields to update, nil fields are left untouched.
+type UpdateRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Surname     *string `json:"surname,omitempty"`
+	Patronymic  *string `json:"patronymic,omitempty"`
+	Age         *int8   `json:"age,omitempty"`
+	Gender      *string `json:"gender,omitempty"`
+	Nationality *string `json:"nationality,omitempty"`
+}
+
+// DuplicateCluster is a group of persons with similar names, Similarity is the highest similarity
+// of pairs in the group.
+type DuplicateCluster struct {
+	Persons    []Person `json:"Persons"`
+	Similarity float64  `json:"Similarity"`
+}
+
+// Create creates person and returns its id. Age, gender and nationality are filled in by the server.
+// Depending on duplicate policy of the server, person with the same name is rejected with ErrConflict,
+// or its id is returned.
+func (c *Client) Create(ctx context.Context, req CreateRequest) (string, error) {
+	// created person is answered with {"id"}, existing one with the whole person, keys match case-insensitively
+	var resp struct {
+		ID string `json:"id"`
+	}
+
+	if err := c.do(ctx, http.MethodPost, personsPath, nil, req, &resp); err != nil {
+		return "", err
+	}
+
+	return resp.ID, nil
+}
+
+func (c *Client) Get(ctx context.Context, id string) (*Person, error) {
+	if id == "" {
+		return nil, errors.New("person id is empty")
+	}
+
+	var person Person
+	if err := c.do(ctx, http.MethodGet, personsPath+url.PathEscape(id), nil, nil, &person); err != nil {
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+// Update returns person as it is after the update.
+func (c *Client) Update(ctx context.Context, id string, req UpdateRequest) (*Person, error) {
+	if id == "" {
+		return nil, errors.New("person id is empty")
+	}
+
+	var person Person
+	if err := c.do(ctx, http.MethodPut, personsPath+url.PathEscape(id), nil, req, &person); err != nil {
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+// Delete returns deleted person.
+func (c *Client) Delete(ctx context.Context, id string) (*Person, error) {
+	if id == "" {
+		return nil, errors.New("person id is empty")
+	}
+
+	var person Person
+	if err := c.do(ctx, http.MethodDelete, personsPath+url.PathEscape(id), nil, nil, &person); err != nil {
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+// Duplicates returns clusters of persons with similar names built of at most limit most similar pairs,
+// zero limit and similarity mean server defaults.
+func (c *Client) Duplicates(ctx context.Context, similarity float64, limit int) ([]DuplicateCluster, error) {
+	query := url.Values{}
+	if similarity > 0 {
+		query.Set("similarity", strconv.FormatFloat(similarity, 'f', -1, 64))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var clusters []DuplicateCluster
+	if err := c.do(ctx, http.MethodGet, duplicatesPath, query, nil, &clusters); err != nil {
+		return nil, err
+	}
+
+	return clusters, nil
+}
+
+// Merge merges sources into target and deletes them, it returns merged target.
+func (c *Client) Merge(ctx context.Context, targetID string, sourceIDs ...string) (*Person, error) {
+	if targetID == "" || len(sourceIDs) == 0 {
+		return nil, errors.New("target and source ids are required")
+	}
+
+	req := struct {
+		TargetID  string   `json:"target_id"`
+		SourceIDs []string `json:"source_ids"`
+	}{TargetID: targetID, SourceIDs: sourceIDs}
+
+	var person Person
+	if err := c.do(ctx, http.MethodPost, mergePath, nil, req, &person); err != nil {
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+// ListPage returns a single page of persons after cursor, zero Cursor means the first page.
+// Returned cursor points to the last person of the page and is zero when there are no more pages.
+func (c *Client) ListPage(ctx context.Context, filter *Filter, cursor Cursor, limit int) ([]Person, Cursor, error) {
+	if limit <= 0 {
+		return nil, Cursor{}, errors.New("limit must be greater than 0")
+	}
+
+	query := filter.values()
+	cursor.apply(query)
+	query.Set("limit", strconv.Itoa(limit))
+
+	var persons []Person
+	if err := c.do(ctx, http.MethodGet, personsPath, query, nil, &persons); err != nil {
+		return nil, Cursor{}, err
+	}
+
+	if len(persons) < limit {
+		return persons, Cursor{}, nil
+	}
+
+	return persons, cursorOf(&persons[len(persons)-1]), nil
+}
+
+// List returns iterator walking through all persons matching filter, fetching pageSize persons at a time.
+func (c *Client) List(filter *Filter, pageSize int) *Iterator {
+	return &Iterator{
+		client:   c,
+		filter:   filter,
+		pageSize: pageSize,
+	}
+}